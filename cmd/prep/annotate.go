@@ -0,0 +1,130 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"log"
+	"sort"
+)
+
+const (
+	// queryDirective forces the value of the constant, the variable
+	// or the string literal into the statements
+	queryDirective = "//prep:query"
+	// ignoreDirective excludes the calls and the constants of the
+	// call, the statement or the declaration from the statements
+	ignoreDirective = "//prep:ignore"
+)
+
+type (
+	// nodeRange is the range of the positions of a node
+	nodeRange struct {
+		pos, end token.Pos
+	}
+)
+
+// annotatedNodes returns the nodes of the file the comments with the
+// directive are associated with by the comment map of the file, both
+// the preceding and the same line comments are associated
+func annotatedNodes(fs *token.FileSet, file *ast.File, directive string) []ast.Node {
+	var nodes []ast.Node
+	for node, groups := range ast.NewCommentMap(fs, file, file.Comments) {
+		if _, ok := node.(*ast.File); ok {
+			// the comments of the file not associated with any node
+			continue
+		}
+		if hasDirective(directive, groups...) {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Pos() < nodes[j].Pos() })
+	return nodes
+}
+
+// ignoredAt reports whether the position is within a node annotated
+// with //prep:ignore
+func (f *queryFinder) ignoredAt(pos token.Pos) bool {
+	for _, r := range f.ignored {
+		if pos >= r.pos && pos < r.end {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoredConst reports whether the query argument refers to a constant
+// or a variable declared within a node annotated with //prep:ignore
+func (f *queryFinder) ignoredConst(queryArg ast.Expr) bool {
+	if obj := f.constOf(queryArg); obj != nil && obj.Pkg() == f.pkg {
+		return f.ignoredAt(obj.Pos())
+	}
+	if ident, ok := queryArg.(*ast.Ident); ok {
+		if obj, ok := f.info.Uses[ident].(*types.Var); ok {
+			return f.ignoredAt(obj.Pos())
+		}
+	}
+	return false
+}
+
+// forceQueries adds the values of the constants, the variables and the
+// string literals the nodes annotated with //prep:query hold to the
+// queries, they don't need to be passed to any matched call
+func (f *queryFinder) forceQueries(node ast.Node) {
+	pos := f.fs.Position(node.Pos())
+	specs := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		vs, ok := n.(*ast.ValueSpec)
+		if !ok {
+			return true
+		}
+
+		specs++
+		for _, name := range vs.Names {
+			var value, constName string
+			switch obj := f.info.Defs[name].(type) {
+			case *types.Const:
+				value, constName = f.constValue(obj)
+			case *types.Var:
+				value, constName = f.constVars[obj], f.constName(obj)
+			}
+			if value == "" {
+				f.warnf(name, "%s: %s is not a string constant, ignored", queryDirective, name.Name)
+				continue
+			}
+			f.force(name, value, constName)
+		}
+		return false
+	})
+	if specs > 0 {
+		return
+	}
+
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			f.force(lit, lit.Value, "")
+			found = true
+		}
+		return true
+	})
+	if !found {
+		log.Printf("prep: %s:%d: warning: %s: no string constant or literal found, ignored", pos.Filename, pos.Line, queryDirective)
+	}
+}
+
+// force adds the query forced by //prep:query found at the node
+func (f *queryFinder) force(node ast.Node, value, name string) {
+	pos := f.fs.Position(node.Pos())
+	obj := f.info.Defs[identOf(node)]
+	_, noValidate := f.noValidate[obj]
+	f.queries = append(f.queries, query{Value: value, Name: name, File: f.declFile(obj), Pos: []token.Position{pos}, NoValidate: noValidate})
+	f.record(callSite{Pos: pos, Method: queryDirective[2:], Status: siteExtracted, Name: name, Reason: "forced by " + queryDirective})
+	f.logf(node, "%s: forced", queryDirective)
+}
+
+// identOf returns the node if it is an identifier, nil otherwise
+func identOf(node ast.Node) *ast.Ident {
+	ident, _ := node.(*ast.Ident)
+	return ident
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"go/build/constraint"
+	"go/parser"
+	"go/token"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// maxConfigTags is the most custom tags of a build constraint which
+// combinations are tried by -all-build-configs
+const maxConfigTags = 8
+
+// architectures are the GOARCH the build constraints may name
+var architectures = []string{
+	"386", "amd64", "arm", "arm64", "loong64", "mips", "mipsle", "mips64", "mips64le",
+	"ppc64", "ppc64le", "riscv64", "s390x", "wasm",
+}
+
+// unixPlatforms are the GOOS satisfying the unix build constraint
+var unixPlatforms = []string{
+	"aix", "android", "darwin", "dragonfly", "freebsd", "hurd", "illumos", "ios",
+	"linux", "netbsd", "openbsd", "solaris",
+}
+
+// buildConfigs returns the comma separated custom tags of the distinct
+// build configurations selecting the files of the packages left out by
+// the loaded configuration, the files which constraints can't be
+// satisfied by the tags for the loaded platform are left out
+func buildConfigs(pkgs []*packages.Package, opts *options) []string {
+	goos, goarch := opts.goos, opts.goarch
+	if goos == "" {
+		goos = envOr("GOOS", runtime.GOOS)
+	}
+	if goarch == "" {
+		goarch = envOr("GOARCH", runtime.GOARCH)
+	}
+
+	set := map[string]bool{}
+	if opts.tags != "" {
+		for _, tag := range strings.Split(opts.tags, ",") {
+			set[tag] = true
+		}
+	}
+
+	configs := map[string]struct{}{}
+	seen := map[string]struct{}{}
+	for _, p := range pkgs {
+		for _, file := range p.IgnoredFiles {
+			if _, ok := seen[file]; ok || !strings.HasSuffix(file, ".go") {
+				continue
+			}
+			seen[file] = struct{}{}
+
+			expr := fileConstraint(file)
+			if expr == nil {
+				continue
+			}
+			if tags, ok := satisfyingTags(expr, goos, goarch, set); ok && tags != "" {
+				configs[tags] = struct{}{}
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(configs))
+	for tags := range configs {
+		sorted = append(sorted, tags)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// envOr returns the value of the environment variable or the fallback
+// if it is empty
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// fileConstraint returns the build constraint of the Go file, nil if it
+// has none or can't be read
+func fileConstraint(path string) constraint.Expr {
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+
+	var plus []constraint.Expr
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, c := range group.List {
+			switch {
+			case constraint.IsGoBuild(c.Text):
+				expr, err := constraint.Parse(c.Text)
+				if err != nil {
+					return nil
+				}
+				return expr
+			case constraint.IsPlusBuild(c.Text):
+				if expr, err := constraint.Parse(c.Text); err == nil {
+					plus = append(plus, expr)
+				}
+			}
+		}
+	}
+
+	if len(plus) == 0 {
+		return nil
+	}
+	expr := plus[0]
+	for _, e := range plus[1:] {
+		expr = &constraint.AndExpr{X: expr, Y: e}
+	}
+	return expr
+}
+
+// satisfyingTags returns the comma separated smallest combination of
+// the custom tags of the constraint satisfying it for the platform
+// together with the tags already set, ok is false if none does
+func satisfyingTags(expr constraint.Expr, goos, goarch string, set map[string]bool) (tags string, ok bool) {
+	var custom []string
+	seen := map[string]struct{}{}
+	expr.Eval(func(tag string) bool {
+		if _, ok := seen[tag]; !ok && !set[tag] && !isPlatformTag(tag) {
+			seen[tag] = struct{}{}
+			custom = append(custom, tag)
+		}
+		return false
+	})
+	sort.Strings(custom)
+	if len(custom) > maxConfigTags {
+		return "", false
+	}
+
+	// the combinations are tried by their size, then by their tags
+	for size := 0; size <= len(custom); size++ {
+		for mask := 0; mask < 1<<len(custom); mask++ {
+			var combination []string
+			for i, tag := range custom {
+				if mask&(1<<i) != 0 {
+					combination = append(combination, tag)
+				}
+			}
+			if len(combination) != size {
+				continue
+			}
+
+			enabled := map[string]bool{}
+			for _, tag := range combination {
+				enabled[tag] = true
+			}
+			matched := expr.Eval(func(tag string) bool {
+				return set[tag] || enabled[tag] || platformTag(tag, goos, goarch)
+			})
+			if matched {
+				return strings.Join(combination, ","), true
+			}
+		}
+	}
+	return "", false
+}
+
+// isPlatformTag reports whether the tag is set by the go command
+// rather than by -tags
+func isPlatformTag(tag string) bool {
+	switch tag {
+	case "unix", "cgo", "gc", "gccgo", "ignore":
+		return true
+	}
+	if strings.HasPrefix(tag, "go1.") {
+		return true
+	}
+	for _, name := range append(append([]string{}, platforms...), architectures...) {
+		if tag == name {
+			return true
+		}
+	}
+	return false
+}
+
+// platformTag reports whether the go command sets the tag for the
+// platform, the custom tags are never set
+func platformTag(tag, goos, goarch string) bool {
+	switch tag {
+	case goos, goarch, "gc", "cgo":
+		return true
+	case "unix":
+		for _, name := range unixPlatforms {
+			if name == goos {
+				return true
+			}
+		}
+	case "linux":
+		return goos == "android"
+	case "solaris":
+		return goos == "illumos"
+	case "darwin":
+		return goos == "ios"
+	}
+	return strings.HasPrefix(tag, "go1.")
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+type (
+	// sqlWord is a keyword or an identifier of the SQL text and the
+	// depth of the parentheses it is found at
+	sqlWord struct {
+		text  string
+		depth int
+	}
+)
+
+// statementGroups maps the groups of the statement kinds accepted by
+// -deny to their kinds
+var statementGroups = map[string][]string{
+	"ddl": {"create", "alter", "drop", "truncate", "comment", "rename"},
+	"dml": {"insert", "update", "delete", "merge", "upsert", "replace"},
+	"dcl": {"grant", "revoke"},
+}
+
+// statementKinds are the kinds of the statements named by their
+// leading keywords
+var statementKinds = []string{
+	"select", "insert", "update", "delete", "merge", "upsert", "replace",
+	"create", "alter", "drop", "truncate", "comment", "rename",
+	"grant", "revoke", "call", "do", "exec", "execute",
+	"lock", "vacuum", "analyze", "explain", "set", "show",
+	"begin", "commit", "rollback", "savepoint", "release",
+}
+
+// withVerbs are the verbs of the statements a WITH clause may precede
+var withVerbs = map[string]bool{
+	"select": true, "insert": true, "update": true, "delete": true, "merge": true,
+}
+
+// denyList returns the statement kinds denied by the comma separated
+// kinds and groups of the -deny option
+func denyList(kinds []string) (map[string]bool, error) {
+	denied := map[string]bool{}
+	for _, kind := range kinds {
+		kind = strings.ToLower(kind)
+		if group, ok := statementGroups[kind]; ok {
+			for _, k := range group {
+				denied[k] = true
+			}
+			continue
+		}
+
+		if !isStatementKind(kind) {
+			groups := make([]string, 0, len(statementGroups))
+			for g := range statementGroups {
+				groups = append(groups, g)
+			}
+			sort.Strings(groups)
+			return nil, fmt.Errorf("unknown statement kind %q, must be one of %s or %s",
+				kind, strings.Join(groups, ", "), strings.Join(statementKinds, ", "))
+		}
+		denied[kind] = true
+	}
+	return denied, nil
+}
+
+// isStatementKind reports whether the kind is a known statement kind
+func isStatementKind(kind string) bool {
+	for _, k := range statementKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// classify returns the kind of the statement, its leading keyword in
+// lower case or, for the statements starting with WITH, the first top
+// level verb following the common table expressions, comments and
+// quoted strings are skipped
+func classify(sql string) string {
+	segments, _ := splitSQL(sql)
+
+	leading := ""
+	depth := 0
+	for _, s := range segments {
+		if s.kind != segmentCode {
+			continue
+		}
+
+		for _, word := range sqlWords(s.text, &depth) {
+			if word.depth > 0 {
+				continue
+			}
+
+			w := strings.ToLower(word.text)
+			if leading == "" {
+				if w != "with" {
+					return w
+				}
+				leading = w
+				continue
+			}
+
+			if withVerbs[w] {
+				return w
+			}
+		}
+	}
+
+	return leading
+}
+
+// sqlWords returns the words of the code segment, depth tracks the
+// parentheses across the segments
+func sqlWords(text string, depth *int) []sqlWord {
+	var words []sqlWord
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '(':
+			*depth++
+		case c == ')':
+			*depth--
+		case isIdentByte(c):
+			end := i
+			for end < len(text) && isIdentByte(text[end]) {
+				end++
+			}
+			words = append(words, sqlWord{text[i:end], *depth})
+			i = end
+			continue
+		}
+		i++
+	}
+	return words
+}
+
+// checkDenied returns an error if any of the queries is of a denied
+// kind, every such query is logged with the calls it is found at
+func checkDenied(queries []query, kinds []string) error {
+	denied, err := denyList(kinds)
+	if err != nil {
+		return err
+	}
+
+	n := 0
+	for _, q := range queries {
+		kind := classify(unquote(q.Value))
+		if !denied[kind] {
+			continue
+		}
+
+		n++
+		if len(q.Pos) == 0 {
+			log.Printf("prep: denied %s statement %s", kind, q.Value)
+		}
+		for _, pos := range q.Pos {
+			log.Printf("prep: %s:%d: denied %s statement %s", pos.Filename, pos.Line, kind, q.Value)
+		}
+	}
+
+	if n > 0 {
+		return fmt.Errorf("%d queries of the kinds denied by -deny %s", n, strings.Join(kinds, ","))
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configFileNames are the names of the configuration files discovered
+// in the package directory and the module root, in their precedence
+var configFileNames = []string{".prep.yaml", ".prep.json"}
+
+type (
+	// config holds the options of the configuration file, the nil
+	// fields are not configured
+	config struct {
+		Methods   []string `json:"methods"`
+		Receivers []string `json:"receivers"`
+		Exclude   []string `json:"exclude"`
+		Dialect   *string  `json:"dialect"`
+		Filename  *string  `json:"filename"`
+		Normalize *bool    `json:"normalize"`
+	}
+)
+
+// configKeys are the keys of the configuration file
+var configKeys = []string{"methods", "receivers", "exclude", "dialect", "filename", "normalize"}
+
+// configure returns the options of the package located in dir combined
+// with its configuration file and the path of the file, empty if there
+// is none, the flags set explicitly override the file
+func configure(dir string, opts *options) (*options, string, error) {
+	path := opts.configFile
+	if path == "" {
+		var err error
+		if path, err = findConfig(dir); err != nil || path == "" {
+			return opts, "", err
+		}
+	}
+
+	cfg, err := readConfig(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	configured, err := cfg.apply(opts)
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: %v", path, err)
+	}
+
+	return configured, path, nil
+}
+
+// findConfig returns the path of the configuration file found in dir
+// or in the root of its module, an empty string if there is none
+func findConfig(dir string) (string, error) {
+	dirs := []string{dir}
+	if root := moduleRoot(dir); root != "" && root != dir {
+		dirs = append(dirs, root)
+	}
+
+	for _, d := range dirs {
+		for _, name := range configFileNames {
+			path := filepath.Join(d, name)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			} else if !os.IsNotExist(err) {
+				return "", fmt.Errorf("failed to check config file: %v", err)
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// moduleRoot returns the closest directory containing dir and a go.mod
+// file, an empty string if there is none
+func moduleRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// readConfig reads the configuration file, the .json files are JSON
+// documents, the others are YAML
+func readConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	cfg := &config{}
+	if filepath.Ext(path) == ".json" {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return nil, fmt.Errorf("%s: %v, known keys are %s", path, err, strings.Join(configKeys, ", "))
+		}
+		return cfg, nil
+	}
+
+	if err := parseYAMLConfig(path, data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// apply returns the copy of the options configured by the file, the
+// flags set explicitly are kept
+func (cfg *config) apply(opts *options) (*options, error) {
+	configured := *opts
+
+	if cfg.Methods != nil {
+		methods := methodFlag{}
+		for _, m := range cfg.Methods {
+			if err := methods.Set(m); err != nil {
+				return nil, err
+			}
+		}
+		for name, index := range opts.methods {
+			methods[name] = index
+		}
+		configured.methods = methods
+	}
+	if cfg.Receivers != nil {
+		// the receivers of the flags add to the configured ones
+		configured.receivers = append(append(listFlag{}, cfg.Receivers...), opts.receivers...)
+	}
+	if cfg.Exclude != nil && !opts.setFlags["exclude"] {
+		configured.exclude = cfg.Exclude
+	}
+	if cfg.Dialect != nil && !opts.setFlags["dialect"] {
+		configured.dialect = *cfg.Dialect
+	}
+	if cfg.Filename != nil && !opts.setFlags["filename"] && !opts.setFlags["o"] {
+		configured.fileName = *cfg.Filename
+	}
+	if cfg.Normalize != nil && !opts.setFlags["normalize"] {
+		configured.normalize = *cfg.Normalize
+	}
+
+	if err := validateOptions(&configured); err != nil {
+		return nil, err
+	}
+
+	return &configured, nil
+}
+
+// parseYAMLConfig parses the subset of YAML the configuration file is
+// written in: the top level keys holding either a scalar, a flow list
+// or a block list of scalars, comments start with #
+func parseYAMLConfig(path string, data []byte, cfg *config) error {
+	values := map[string][]string{}
+	lists := map[string]bool{}
+	var key string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimRight(stripYAMLComment(scanner.Text()), " \t")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if trimmed := strings.TrimLeft(line, " \t"); strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if key == "" || len(trimmed) == len(line) || !lists[key] {
+				return fmt.Errorf("%s:%d: unexpected list item", path, n)
+			}
+			item, err := yamlScalar(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", path, n, err)
+			}
+			values[key] = append(values[key], item)
+			continue
+		}
+
+		if line[0] == ' ' || line[0] == '\t' {
+			return fmt.Errorf("%s:%d: unexpected indentation, only top level keys are supported", path, n)
+		}
+
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("%s:%d: expected key: value", path, n)
+		}
+		key = strings.TrimSpace(k)
+		if !isConfigKey(key) {
+			return fmt.Errorf("%s:%d: unknown key %q, known keys are %s", path, n, key, strings.Join(configKeys, ", "))
+		}
+		if _, ok := values[key]; ok {
+			return fmt.Errorf("%s:%d: duplicate key %q", path, n, key)
+		}
+
+		v = strings.TrimSpace(v)
+		switch {
+		case v == "":
+			// the block list follows
+			values[key], lists[key] = []string{}, true
+		case strings.HasPrefix(v, "["):
+			items, err := yamlFlowList(v)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", path, n, err)
+			}
+			values[key], lists[key] = items, true
+		default:
+			scalar, err := yamlScalar(v)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", path, n, err)
+			}
+			values[key] = []string{scalar}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := cfg.set(k, values[k], lists[k]); err != nil {
+			return fmt.Errorf("%s: %s: %v", path, k, err)
+		}
+	}
+
+	return nil
+}
+
+// set sets the configuration option parsed from the YAML file
+func (cfg *config) set(key string, values []string, list bool) error {
+	switch key {
+	case "methods", "receivers", "exclude":
+		switch key {
+		case "methods":
+			cfg.Methods = values
+		case "receivers":
+			cfg.Receivers = values
+		default:
+			cfg.Exclude = values
+		}
+		return nil
+	}
+
+	if list {
+		return errors.New("expected a single value, not a list")
+	}
+
+	switch key {
+	case "dialect":
+		cfg.Dialect = &values[0]
+	case "filename":
+		cfg.Filename = &values[0]
+	case "normalize":
+		b, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return fmt.Errorf("expected true or false, not %q", values[0])
+		}
+		cfg.Normalize = &b
+	}
+
+	return nil
+}
+
+// isConfigKey reports whether the key is a key of the configuration file
+func isConfigKey(key string) bool {
+	for _, k := range configKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// stripYAMLComment returns the line without its comment, the #
+// characters in the quoted scalars are kept
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlScalar returns the value of the plain or quoted YAML scalar
+func yamlScalar(s string) (string, error) {
+	switch {
+	case s == "":
+		return "", errors.New("empty value, null is not supported")
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("unterminated quoted value %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.ContainsAny(s[:1], "[]{}&*!|>%@`"):
+		return "", fmt.Errorf("unsupported value %s", s)
+	}
+	return s, nil
+}
+
+// yamlFlowList returns the items of the YAML flow list of scalars
+func yamlFlowList(s string) ([]string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("unterminated list %s", s)
+	}
+
+	items := []string{}
+	for _, item := range splitYAMLFlow(s[1 : len(s)-1]) {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		scalar, err := yamlScalar(item)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, scalar)
+	}
+	return items, nil
+}
+
+// splitYAMLFlow returns the items of the YAML flow list split at the
+// commas, the commas of the quoted scalars are kept
+func splitYAMLFlow(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
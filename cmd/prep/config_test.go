@@ -0,0 +1,93 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAMLConfig(t *testing.T) {
+	dialect, filename, normalize := "postgres", "queries.go", true
+
+	tests := []struct {
+		name string
+		yaml string
+		want config
+		err  string
+	}{
+		{
+			name: "block lists",
+			yaml: "methods:\n  - RunQuery:1\n  - Two\nexclude:\n  - '*_gen.go' # generated\n",
+			want: config{Methods: []string{"RunQuery:1", "Two"}, Exclude: []string{"*_gen.go"}},
+		},
+		{
+			name: "flow list",
+			yaml: "receivers: [example.com/cache.DB, 'example.com/store.Tx']\n",
+			want: config{Receivers: []string{"example.com/cache.DB", "example.com/store.Tx"}},
+		},
+		{
+			name: "flow list of quoted commas",
+			yaml: "exclude: [\"a,b\", 'c,d', \"e\\\",f\", 'g'',h', i]\n",
+			want: config{Exclude: []string{"a,b", "c,d", `e",f`, "g',h", "i"}},
+		},
+		{
+			name: "scalars",
+			yaml: "dialect: postgres\nfilename: \"queries.go\"\nnormalize: true\n",
+			want: config{Dialect: &dialect, Filename: &filename, Normalize: &normalize},
+		},
+		{
+			name: "empty list",
+			yaml: "exclude:\n",
+			want: config{Exclude: []string{}},
+		},
+		{
+			name: "empty list item",
+			yaml: "exclude:\n  -\n",
+			err:  ".prep.yaml:2: empty value",
+		},
+		{
+			name: "empty list item with comment",
+			yaml: "exclude:\n  - # none\n",
+			err:  ".prep.yaml:2: empty value",
+		},
+		{
+			name: "unknown key",
+			yaml: "dialects: postgres\n",
+			err:  `.prep.yaml:1: unknown key "dialects"`,
+		},
+		{
+			name: "list of a scalar key",
+			yaml: "dialect: [postgres]\n",
+			err:  ".prep.yaml: dialect: expected a single value",
+		},
+		{
+			name: "unterminated flow list",
+			yaml: "exclude: [a, b\n",
+			err:  ".prep.yaml:1: unterminated list",
+		},
+		{
+			name: "nested key",
+			yaml: "exclude:\n  files: a\n",
+			err:  ".prep.yaml:2: unexpected indentation",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cfg config
+			err := parseYAMLConfig(".prep.yaml", []byte(test.yaml), &cfg)
+			if test.err != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+					t.Fatalf("got error %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg, test.want) {
+				t.Errorf("got %+v, want %+v", cfg, test.want)
+			}
+		})
+	}
+}
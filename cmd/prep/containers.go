@@ -0,0 +1,288 @@
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// queryContainers returns the elements of the unexported package
+// variables of the files initialized to a slice, an array or a map
+// literal of string constant expressions keyed by the constant values
+// of their indexes or map keys, the variables assigned to, addressed or
+// which elements are assigned to anywhere in the package are left out
+func queryContainers(files, packageFiles []*ast.File, info *types.Info) map[types.Object]map[string]ast.Expr {
+	containers := map[types.Object]map[string]ast.Expr{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if len(vs.Values) != len(vs.Names) {
+					continue
+				}
+				for i, name := range vs.Names {
+					lit, ok := vs.Values[i].(*ast.CompositeLit)
+					if !ok || name.IsExported() || info.Defs[name] == nil {
+						continue
+					}
+					if elements := stringElements(lit, info); len(elements) > 0 {
+						containers[info.Defs[name]] = elements
+					}
+				}
+			}
+		}
+	}
+
+	for obj := range changedVars(packageFiles, info) {
+		delete(containers, obj)
+	}
+
+	return containers
+}
+
+// stringElements returns the elements, the values of the map literal,
+// keyed by the constant values of their indexes or keys if all of them
+// are string constant expressions, nil otherwise
+func stringElements(lit *ast.CompositeLit, info *types.Info) map[string]ast.Expr {
+	_, isMap := info.TypeOf(lit).Underlying().(*types.Map)
+	switch info.TypeOf(lit).Underlying().(type) {
+	case *types.Slice, *types.Array, *types.Map:
+	default:
+		return nil
+	}
+
+	elements := make(map[string]ast.Expr, len(lit.Elts))
+	index := int64(0)
+	for _, elt := range lit.Elts {
+		key := constant.MakeInt64(index)
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			tv, ok := info.Types[kv.Key]
+			if !ok || tv.Value == nil {
+				return nil
+			}
+			key, elt = tv.Value, kv.Value
+		}
+		if !isMap {
+			index, _ = constant.Int64Val(constant.ToInt(key))
+			index++
+		}
+
+		tv, ok := info.Types[elt]
+		if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+			return nil
+		}
+		elements[key.ExactString()] = elt
+	}
+	return elements
+}
+
+// rangeVars returns the value variables of the range statements of the
+// files over the containers mapped to the containers
+func rangeVars(files []*ast.File, info *types.Info, containers map[types.Object]map[string]ast.Expr) map[types.Object]types.Object {
+	vars := map[types.Object]types.Object{}
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			rs, ok := node.(*ast.RangeStmt)
+			if !ok || rs.Tok != token.DEFINE || rs.Value == nil {
+				return true
+			}
+
+			x, ok := rs.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			container := info.Uses[x]
+			if _, ok := containers[container]; !ok {
+				return true
+			}
+
+			if value, ok := rs.Value.(*ast.Ident); ok && info.Defs[value] != nil {
+				vars[info.Defs[value]] = container
+			}
+			return true
+		})
+	}
+
+	for obj := range changedVars(files, info) {
+		delete(vars, obj)
+	}
+	return vars
+}
+
+// assignedVars returns the values of the local variables of the files
+// assigned string constant expressions only, the union of the values
+// is the set of the queries the variable may hold, the variables
+// assigned any other value, assigned by an operator or a multi-valued
+// expression or addressed are left out, so are the ones assigned once
+func assignedVars(files []*ast.File, info *types.Info) map[types.Object][]ast.Expr {
+	values := map[types.Object][]ast.Expr{}
+	declared := map[types.Object]struct{}{}
+	invalid := map[types.Object]struct{}{}
+	assign := func(lhs, value ast.Expr) {
+		ident, ok := lhs.(*ast.Ident)
+		if !ok {
+			return
+		}
+		obj := info.Defs[ident]
+		if obj == nil {
+			obj = info.Uses[ident]
+		}
+		if v, ok := obj.(*types.Var); !ok || v.Parent() == nil || v.Parent() == v.Pkg().Scope() {
+			return
+		}
+
+		if value == nil {
+			invalid[obj] = struct{}{}
+			return
+		}
+		if tv, ok := info.Types[value]; !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+			invalid[obj] = struct{}{}
+			return
+		}
+		values[obj] = append(values[obj], value)
+	}
+
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.ValueSpec:
+				for i, name := range n.Names {
+					declared[info.Defs[name]] = struct{}{}
+					switch len(n.Values) {
+					case 0:
+					case len(n.Names):
+						assign(name, n.Values[i])
+					default:
+						assign(name, nil)
+					}
+				}
+			case *ast.AssignStmt:
+				for i, lhs := range n.Lhs {
+					if ident, ok := lhs.(*ast.Ident); ok && n.Tok == token.DEFINE && info.Defs[ident] != nil {
+						declared[info.Defs[ident]] = struct{}{}
+					}
+					if (n.Tok == token.ASSIGN || n.Tok == token.DEFINE) && len(n.Lhs) == len(n.Rhs) {
+						assign(lhs, n.Rhs[i])
+						continue
+					}
+					assign(lhs, nil)
+				}
+			case *ast.RangeStmt:
+				if n.Key != nil {
+					assign(n.Key, nil)
+				}
+				if n.Value != nil {
+					assign(n.Value, nil)
+				}
+			case *ast.UnaryExpr:
+				if n.Op == token.AND {
+					assign(n.X, nil)
+				}
+			}
+			return true
+		})
+	}
+
+	for obj, assigned := range values {
+		_, isDeclared := declared[obj]
+		_, isInvalid := invalid[obj]
+		if !isDeclared || isInvalid || len(assigned) < 2 {
+			delete(values, obj)
+		}
+	}
+	return values
+}
+
+// changedVars returns the variables assigned to, addressed or which
+// elements are assigned to in the files
+func changedVars(files []*ast.File, info *types.Info) map[types.Object]struct{} {
+	vars := map[types.Object]struct{}{}
+	changed := func(expr ast.Expr) {
+		for {
+			switch e := expr.(type) {
+			case *ast.ParenExpr:
+				expr = e.X
+				continue
+			case *ast.IndexExpr:
+				expr = e.X
+				continue
+			case *ast.Ident:
+				if obj := info.Uses[e]; obj != nil {
+					vars[obj] = struct{}{}
+				}
+			}
+			return
+		}
+	}
+
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.AssignStmt:
+				for _, lhs := range n.Lhs {
+					changed(lhs)
+				}
+			case *ast.UnaryExpr:
+				if n.Op == token.AND {
+					changed(n.X)
+				}
+			}
+			return true
+		})
+	}
+	return vars
+}
+
+// containerElements returns the elements of the container the query
+// argument is taken from, either a range variable over the container
+// or an index expression of it, the element of the constant index only,
+// or the values of the variable assigned several string constants, the
+// reason the lookup of the container is dynamic otherwise
+func (f *queryFinder) containerElements(queryArg ast.Expr) (elements []ast.Expr, dynamic string) {
+	switch q := queryArg.(type) {
+	case *ast.Ident:
+		if container, ok := f.rangeVars[f.info.Uses[q]]; ok {
+			return sortedElements(f.containers[container]), ""
+		}
+		return f.assigned[f.info.Uses[q]], ""
+	case *ast.IndexExpr:
+		x, ok := q.X.(*ast.Ident)
+		if !ok {
+			return nil, ""
+		}
+		container, ok := f.containers[f.info.Uses[x]]
+		if !ok {
+			return nil, ""
+		}
+
+		if tv, ok := f.info.Types[q.Index]; ok && tv.Value != nil {
+			if element, ok := container[tv.Value.ExactString()]; ok {
+				return []ast.Expr{element}, ""
+			}
+			return nil, "no element of " + x.Name + " has the key " + tv.Value.ExactString()
+		}
+		if f.dynamicLookups {
+			return nil, "a lookup by a key which isn't constant"
+		}
+		return sortedElements(container), ""
+	}
+	return nil, ""
+}
+
+// sortedElements returns the elements of the container in the order of
+// their positions
+func sortedElements(container map[string]ast.Expr) []ast.Expr {
+	elements := make([]ast.Expr, 0, len(container))
+	for _, element := range container {
+		elements = append(elements, element)
+	}
+	sort.Slice(elements, func(i, j int) bool { return elements[i].Pos() < elements[j].Pos() })
+	return elements
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// SQL dialects of the placeholders
+const (
+	dialectNone     = "none"
+	dialectPostgres = "postgres"
+	dialectMySQL    = "mysql"
+	dialectSQLite   = "sqlite"
+)
+
+// isDialect reports whether the dialect is supported
+func isDialect(dialect string) bool {
+	switch dialect {
+	case dialectNone, dialectPostgres, dialectMySQL, dialectSQLite:
+		return true
+	}
+	return false
+}
+
+// rebindQueries returns the queries with the placeholders rewritten
+// to the dialect, the queries that become equal are collapsed
+func rebindQueries(queries []query, dialect string) []query {
+	if dialect == dialectNone {
+		return queries
+	}
+
+	return rewriteQueries(queries, func(sql string) string { return rebind(sql, dialect) })
+}
+
+// rebind rewrites the placeholders of the statement to the dialect,
+// ? to $N for postgres and $N to ? for mysql and sqlite, the string
+// literals, quoted identifiers and comments of the statement are kept
+func rebind(sql, dialect string) string {
+	var b strings.Builder
+	n := 0
+	segments, _ := splitSQL(sql)
+	for _, s := range segments {
+		if s.kind != segmentCode {
+			b.WriteString(s.text)
+			continue
+		}
+
+		text := s.text
+		for i := 0; i < len(text); {
+			c := text[i]
+			if c != '?' && (c != '$' || i+1 == len(text) || !isDigit(text[i+1])) {
+				b.WriteByte(c)
+				i++
+				continue
+			}
+
+			end := i + 1
+			for c == '$' && end < len(text) && isDigit(text[end]) {
+				end++
+			}
+
+			switch {
+			case dialect != dialectPostgres:
+				b.WriteByte('?')
+			case c == '?':
+				n++
+				fmt.Fprintf(&b, "$%d", n)
+			default:
+				// the numbered placeholders may be repeated
+				b.WriteString(text[i:end])
+			}
+			i = end
+		}
+	}
+	return b.String()
+}
+
+// isDigit reports whether the byte is an ASCII digit
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// hasNamedParams reports whether the statement has the :name parameters
+// of sqlx outside of its string literals, quoted identifiers and
+// comments, the :: casts and escapes aren't parameters
+func hasNamedParams(sql string) bool {
+	segments, _ := splitSQL(sql)
+	for _, s := range segments {
+		if s.kind != segmentCode {
+			continue
+		}
+
+		text := s.text
+		for i := 0; i+1 < len(text); i++ {
+			if text[i] != ':' {
+				continue
+			}
+			if text[i+1] == ':' {
+				i++
+				continue
+			}
+			if c := text[i+1]; c == '_' || unicode.IsLetter(rune(c)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// placeholderCount returns the number of the parameters of the
+// statement, every ? is a parameter of its own while the numbered $N
+// and the named :name parameters may be repeated
+func placeholderCount(sql string) int {
+	count := 0
+	seen := map[string]struct{}{}
+	segments, _ := splitSQL(sql)
+	for _, s := range segments {
+		if s.kind != segmentCode {
+			continue
+		}
+
+		text := s.text
+		for i := 0; i < len(text); i++ {
+			end := i + 1
+			switch c := text[i]; {
+			case c == '?':
+				count++
+				continue
+			case c == '$':
+				for end < len(text) && isDigit(text[end]) {
+					end++
+				}
+			case c == ':' && end < len(text) && text[end] == ':':
+				i++
+				continue
+			case c == ':':
+				for end < len(text) && (text[end] == '_' || unicode.IsLetter(rune(text[end])) || isDigit(text[end])) {
+					end++
+				}
+			}
+
+			if end > i+1 {
+				if _, ok := seen[text[i:end]]; !ok {
+					seen[text[i:end]] = struct{}{}
+					count++
+				}
+				i = end - 1
+			}
+		}
+	}
+	return count
+}
+
+// dummyParams returns the statement with its placeholders substituted
+// with the integer literals of the same length, i.e. $1 with 00, which
+// parse wherever a parameter does, LIMIT including, and keep the
+// offsets of the parse errors those of the statement
+func dummyParams(sql string) string {
+	var b strings.Builder
+	segments, _ := splitSQL(sql)
+	for _, s := range segments {
+		if s.kind != segmentCode {
+			b.WriteString(s.text)
+			continue
+		}
+
+		text := s.text
+		for i := 0; i < len(text); i++ {
+			end := i + 1
+			switch c := text[i]; {
+			case c == '?':
+			case c == '$':
+				for end < len(text) && isDigit(text[end]) {
+					end++
+				}
+			case c == ':' && end < len(text) && (text[end] == ':' || text[end] == '='):
+				// the :: casts and the := assignments
+				b.WriteString(text[i : end+1])
+				i = end
+				continue
+			case c == ':' && end < len(text) && (text[end] == '_' || unicode.IsLetter(rune(text[end]))):
+				for end < len(text) && (text[end] == '_' || unicode.IsLetter(rune(text[end])) || isDigit(text[end])) {
+					end++
+				}
+			}
+
+			if c := text[i]; c == '?' || end > i+1 {
+				b.WriteString(strings.Repeat("0", end-i))
+				i = end - 1
+				continue
+			}
+			b.WriteByte(text[i])
+		}
+	}
+	return b.String()
+}
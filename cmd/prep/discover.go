@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// generateDirectivePrefix starts the go:generate directives
+const generateDirectivePrefix = "//go:generate "
+
+type (
+	// prepDirective is a go:generate directive running the tool
+	prepDirective struct {
+		fileName string
+		line     int
+		// args holds the arguments of the tool
+		args []string
+	}
+)
+
+// discoverAndGenerate generates the code for every go:generate prep
+// directive found in the packages matching the patterns, the flags of
+// the directive configure the generation while the run modes, like
+// -check, are taken from the command line
+func discoverAndGenerate(patterns []string, cmdOpts *options) runResult {
+	cfg := loadConfig(cmdOpts)
+	cfg.Mode = packages.NeedName | packages.NeedFiles
+	pkgs, err := Load(cfg, patterns...)
+	if err != nil {
+		return runResult{exitCode: fatalf("%v", err)}
+	}
+
+	result := runResult{exitCode: exitOK}
+	seen := map[string]struct{}{}
+	for _, p := range pkgs {
+		for _, fileName := range p.GoFiles {
+			directives, err := findDirectives(fileName)
+			if err != nil {
+				log.Printf("prep: %s: %v", p.PkgPath, err)
+				result.exitCode = exitFailure
+				continue
+			}
+
+			for _, d := range directives {
+				// the directive is usually repeated by the generated file
+				key := filepath.Dir(d.fileName) + "\x00" + strings.Join(d.args, "\x00")
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+
+				opts, err := directiveOptions(d, cmdOpts)
+				if err != nil {
+					log.Printf("prep: %s:%d: %v", d.fileName, d.line, err)
+					result.exitCode = exitFailure
+					continue
+				}
+
+				r := generateAll(opts.sourcePackageNames, opts)
+				if r.exitCode != exitOK {
+					result.exitCode = r.exitCode
+				}
+				result.queries += r.queries
+				result.dirs = append(result.dirs, r.dirs...)
+				result.reports = append(result.reports, r.reports...)
+
+				if result.exitCode != exitOK && cmdOpts.failFast {
+					return result
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// directiveOptions returns the options configured by the flags of the
+// directive combined with the run modes of the command line
+func directiveOptions(d prepDirective, cmdOpts *options) (*options, error) {
+	opts := &options{}
+
+	fs := flag.NewFlagSet("prep", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	registerFlags(fs, opts)
+	if err := fs.Parse(d.args); err != nil {
+		return nil, fmt.Errorf("invalid go:generate prep directive: %v", err)
+	}
+	opts.setFlags = setFlags(fs)
+
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("invalid go:generate prep directive: unexpected arguments %q", fs.Args())
+	}
+
+	if len(opts.sourcePackageNames) == 0 {
+		return nil, errors.New("invalid go:generate prep directive: no source packages")
+	}
+
+	// go generate runs the directive in the directory of the file
+	dir := filepath.Dir(d.fileName)
+	for i, name := range opts.sourcePackageNames {
+		if name == "." || name == ".." || strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+			opts.sourcePackageNames[i] = filepath.Join(dir, name)
+		}
+	}
+
+	if opts.dir != "" && !filepath.IsAbs(opts.dir) {
+		opts.dir = filepath.Join(dir, opts.dir)
+	}
+	if opts.configFile != "" && !filepath.IsAbs(opts.configFile) {
+		opts.configFile = filepath.Join(dir, opts.configFile)
+	}
+
+	opts.stdout = opts.stdout || cmdOpts.stdout
+	opts.check = opts.check || cmdOpts.check
+	opts.dryRun = opts.dryRun || cmdOpts.dryRun
+	opts.verbose = opts.verbose || cmdOpts.verbose
+	opts.failFast = opts.failFast || cmdOpts.failFast
+	opts.report = cmdOpts.report
+	opts.json = cmdOpts.json
+	opts.driver, opts.dsn, opts.prepareTimeout = cmdOpts.driver, cmdOpts.dsn, cmdOpts.prepareTimeout
+
+	if err := validateOptions(opts); err != nil {
+		return nil, fmt.Errorf("invalid go:generate prep directive: %v", err)
+	}
+
+	return opts, nil
+}
+
+// findDirectives returns the go:generate directives of the file that
+// run the tool, the file is scanned line by line like go generate does
+func findDirectives(fileName string) ([]prepDirective, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var directives []prepDirective
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if !strings.HasPrefix(text, generateDirectivePrefix) {
+			continue
+		}
+
+		args, err := splitDirective(strings.TrimPrefix(text, generateDirectivePrefix))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", fileName, line, err)
+		}
+
+		if len(args) > 0 && args[0] == "prep" {
+			directives = append(directives, prepDirective{fileName: fileName, line: line, args: args[1:]})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return directives, nil
+}
+
+// splitDirective splits the go:generate directive into the arguments
+// separated by spaces, double quoted arguments are unquoted
+func splitDirective(directive string) ([]string, error) {
+	var args []string
+	for {
+		directive = strings.TrimLeftFunc(directive, unicode.IsSpace)
+		if directive == "" {
+			return args, nil
+		}
+
+		if directive[0] != '"' {
+			end := strings.IndexFunc(directive, unicode.IsSpace)
+			if end < 0 {
+				end = len(directive)
+			}
+			args = append(args, directive[:end])
+			directive = directive[end:]
+			continue
+		}
+
+		// find the closing quote skipping the escaped ones
+		end := 1
+		for ; end < len(directive) && directive[end] != '"'; end++ {
+			if directive[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(directive) {
+			return nil, errors.New("unterminated quoted argument in go:generate directive")
+		}
+
+		arg, err := strconv.Unquote(directive[:end+1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted argument in go:generate directive: %v", err)
+		}
+		args = append(args, arg)
+		directive = directive[end+1:]
+	}
+}
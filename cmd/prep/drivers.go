@@ -0,0 +1,7 @@
+package main
+
+// the database/sql drivers -driver may name, postgres and mysql
+import (
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+)
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// embedDirective is the prefix of the go:embed directive comments
+const embedDirective = "//go:embed "
+
+// embeddedVars returns the Go literals of the contents of the files
+// embedded into the string variables of the files, the variables
+// embedding several files or patterns are reported, -sqldir extracts
+// their statements
+func (f *queryFinder) embeddedVars(files []*ast.File, dir string) (map[types.Object]string, error) {
+	values := map[types.Object]string{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				patterns, err := embedPatterns(gen.Doc, vs.Doc)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %v", f.fs.Position(vs.Pos()), err)
+				}
+				if len(patterns) == 0 || len(vs.Names) != 1 {
+					continue
+				}
+
+				obj := f.info.Defs[vs.Names[0]]
+				if basic, ok := obj.Type().Underlying().(*types.Basic); !ok || basic.Kind() != types.String {
+					f.warnf(vs, "%s embeds %s, use -sqldir to extract its statements", vs.Names[0].Name, strings.Join(patterns, " "))
+					continue
+				}
+				if len(patterns) > 1 {
+					continue
+				}
+
+				path := filepath.Join(dir, filepath.FromSlash(patterns[0]))
+				if strings.ContainsAny(patterns[0], "*?[") {
+					// the string embeds the file if the pattern matches
+					// only one
+					matches, err := filepath.Glob(path)
+					if err != nil || len(matches) != 1 {
+						f.warnf(vs, "%s embeds %s, use -sqldir to extract its statements", vs.Names[0].Name, patterns[0])
+						continue
+					}
+					path = matches[0]
+				}
+
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read embedded file: %v", err)
+				}
+				values[obj] = sqlLiteral(string(data))
+			}
+		}
+	}
+	return values, nil
+}
+
+// embedPatterns returns the patterns of the go:embed directives of the
+// comment groups
+func embedPatterns(groups ...*ast.CommentGroup) ([]string, error) {
+	var patterns []string
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		for _, c := range group.List {
+			if !strings.HasPrefix(c.Text, embedDirective) {
+				continue
+			}
+
+			args, err := embedArgs(strings.TrimSpace(c.Text[len(embedDirective):]))
+			if err != nil {
+				return nil, err
+			}
+			patterns = append(patterns, args...)
+		}
+	}
+	return patterns, nil
+}
+
+// embedArgs splits the arguments of the go:embed directive, the quoted
+// arguments are unquoted
+func embedArgs(text string) ([]string, error) {
+	var args []string
+	for text != "" {
+		end := strings.IndexAny(text, " \t")
+		if text[0] == '"' || text[0] == '`' {
+			end = strings.IndexByte(text[1:], text[0]) + 2
+			if end == 1 {
+				return nil, fmt.Errorf("unterminated go:embed argument %s", text)
+			}
+		}
+		if end < 0 {
+			end = len(text)
+		}
+
+		arg := text[:end]
+		if arg[0] == '"' || arg[0] == '`' {
+			var err error
+			if arg, err = strconv.Unquote(arg); err != nil {
+				return nil, fmt.Errorf("invalid go:embed argument %s", text[:end])
+			}
+		}
+		args = append(args, arg)
+		text = strings.TrimLeft(text[end:], " \t")
+	}
+	return args, nil
+}
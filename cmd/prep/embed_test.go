@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEmbeddedVars(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "queries"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, sql := range map[string]string{
+		"ping.sql":            "SELECT 1\n",
+		"select_user.sql":     "SELECT name FROM users WHERE id = $1\n",
+		"delete_user.sql":     "DELETE FROM users WHERE id = $1\n",
+		"delete_sessions.sql": "DELETE FROM sessions WHERE user_id = $1\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, "queries", name), []byte(sql), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	src := `package store
+
+var (
+	//go:embed queries/ping.sql
+	ping string
+
+	// the pattern matches a single file
+	//go:embed queries/select_*.sql
+	selectUser string
+
+	// the patterns matching several files or none can't be embedded
+	// into a string
+	//go:embed queries/delete_*.sql
+	deleteUser string
+	//go:embed queries/update_*.sql
+	updateUser string
+)
+`
+	fs := token.NewFileSet()
+	file, err := parser.ParseFile(fs, filepath.Join(dir, "store.go"), src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}}
+	if _, err := (&types.Config{}).Check("example.com/store", fs, []*ast.File{file}, info); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := &bytes.Buffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	f := &queryFinder{fs: fs, info: info}
+	values, err := f.embeddedVars([]*ast.File{file}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]string{}
+	for obj, value := range values {
+		got[obj.Name()] = value
+	}
+	want := map[string]string{
+		"ping":       sqlLiteral("SELECT 1\n"),
+		"selectUser": sqlLiteral("SELECT name FROM users WHERE id = $1\n"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got values %q, want %q", got, want)
+	}
+
+	for _, line := range []string{
+		"store.go:14: warning: deleteUser embeds queries/delete_*.sql, use -sqldir to extract its statements",
+		"store.go:16: warning: updateUser embeds queries/update_*.sql, use -sqldir to extract its statements",
+	} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("the log misses %s:\n%s", line, logs)
+		}
+	}
+	if strings.Contains(logs.String(), "selectUser embeds") {
+		t.Errorf("the pattern matching a single file is reported:\n%s", logs)
+	}
+}
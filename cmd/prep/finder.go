@@ -0,0 +1,1697 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+type (
+	queryFinder struct {
+		// noValidate holds the constants annotated with the
+		// //prep:novalidate comment
+		noValidate map[types.Object]struct{}
+		queries    []query
+
+		fs      *token.FileSet
+		verbose bool
+		// seen holds the positions of the visited call sites, so the
+		// files shared by the test variants of a package count once,
+		// it is reset for every build configuration
+		seen map[token.Position]struct{}
+		// config is the build configuration of the scanned packages
+		config string
+		// recorded holds the recorded call sites, the sites of the
+		// files shared by the build configurations count once
+		recorded map[callSite]struct{}
+
+		// exclude holds the glob patterns of the files not to scan
+		exclude []string
+		// generatedFiles are the paths of the files the tool
+		// generates, they are never scanned
+		generatedFiles []string
+		// skippedFiles holds the files that were not scanned
+		skippedFiles map[string]struct{}
+		// includeGenerated makes the files carrying the Code generated
+		// header to be scanned
+		includeGenerated bool
+
+		// methods maps the names of the matched methods to the
+		// indexes of their query arguments
+		methods map[string]int
+		// anyReceiver holds the names of the methods matched whatever
+		// their receiver is
+		anyReceiver map[string]struct{}
+		// receivers maps the import path qualified names of the
+		// database handle types to the method matchers of them
+		receivers map[string]map[string]int
+		// names holds the names of the methods of all of the receivers
+		names map[string]struct{}
+		// info holds the types of the scanned package
+		info *types.Info
+		pkg  *types.Package
+		// skipped holds the files of the scanned package that are not
+		// scanned
+		skipped map[string]struct{}
+		// constVars maps the effectively constant package and local
+		// variables to their values
+		constVars map[types.Object]string
+		// varChanges holds the positions the variables initialized to
+		// a constant are changed at
+		varChanges map[types.Object][]token.Pos
+		// containers maps the package variables holding the literals of
+		// the query constants to the elements of them keyed by the
+		// constant values of their indexes or map keys
+		containers map[types.Object]map[string]ast.Expr
+		// dynamicLookups makes the lookups of the containers by the
+		// keys which aren't constant dynamic call sites instead of
+		// extracting every element
+		dynamicLookups bool
+		// rangeVars maps the variables ranging over the containers to
+		// the containers
+		rangeVars map[types.Object]types.Object
+		// params maps the parameters of the functions of the package
+		// to them
+		params map[types.Object]parameter
+		// changed holds the variables changed in the package
+		changed map[types.Object]struct{}
+		// inCalls maps the variables holding the queries expanded by
+		// sqlx.In to the calls
+		inCalls map[types.Object]*ast.CallExpr
+		// assigned maps the local variables assigned several string
+		// constants to the constants
+		assigned map[types.Object][]ast.Expr
+		// inits maps the local variables to the values they are
+		// initialized to
+		inits map[types.Object]ast.Expr
+		// templates holds the constant format strings of the queries
+		// formatted by fmt.Sprintf
+		templates []query
+		// ignored holds the ranges of the nodes annotated with
+		// //prep:ignore
+		ignored []nodeRange
+		// methodValues maps the local variables holding the method
+		// values to their selectors
+		methodValues map[types.Object]*ast.SelectorExpr
+		// sinks maps the wrappers, the functions passing parameters
+		// to the matched calls, to the indexes of the parameters
+		sinks map[*types.Func][]int
+		// wrapperPass is set while the calls of the wrappers are
+		// visited
+		wrapperPass bool
+		// suggested holds the methods suggested to be matched
+		suggested map[string]struct{}
+		// handles holds the receiver types found in the imports of
+		// the scanned package, the interfaces they implement are
+		// database handles too
+		handles []handle
+
+		// sites holds the matched method calls in the order they
+		// were visited
+		sites []callSite
+	}
+
+	// callSite is a matched method call and the outcome of the
+	// extraction of its query
+	callSite struct {
+		Pos    token.Position
+		Method string
+		Status siteStatus
+		// Name is the name of the constant the query is defined by
+		Name string
+		// Expr is the source text of the query argument, empty if
+		// the argument is missing
+		Expr   string
+		Reason string
+	}
+
+	// siteStatus is the outcome of the extraction of a query
+	siteStatus string
+
+	// parameter is a parameter of a function and its index
+	parameter struct {
+		fn    *types.Func
+		index int
+	}
+
+	// handle is a database handle type and the method matchers of it
+	handle struct {
+		typ     types.Type
+		methods map[string]int
+	}
+)
+
+// statuses of the call sites
+const (
+	// siteExtracted is a query found in the string literal or constant
+	siteExtracted siteStatus = "extracted"
+	// siteDynamic is a query built at run time
+	siteDynamic siteStatus = "dynamic"
+	// siteOdd is a call which signature doesn't match the method matcher
+	siteOdd siteStatus = "odd"
+	// siteIgnored is a call suppressed by //prep:ignore
+	siteIgnored siteStatus = "ignored"
+	// siteExcluded is a query dropped by -exclude-query
+	siteExcluded siteStatus = "excluded"
+)
+
+// newQueryFinder returns a query finder collecting the queries of
+// the packages loaded into the file set, methods extend and override
+// the built-in method matchers and are matched on any receiver, the
+// built-in ones only on the database handles and the receivers
+func newQueryFinder(fs *token.FileSet, methods map[string]int, receivers []string) *queryFinder {
+	f := &queryFinder{
+		fs:           fs,
+		seen:         map[token.Position]struct{}{},
+		recorded:     map[callSite]struct{}{},
+		skippedFiles: map[string]struct{}{},
+		suggested:    map[string]struct{}{},
+		methods:      make(map[string]int, len(methodQueryArgs)+len(methods)),
+		anyReceiver:  make(map[string]struct{}, len(methods)),
+		receivers:    make(map[string]map[string]int, len(handleTypes)+len(handleInterfaces)+len(pgxHandleTypes)+len(receivers)),
+	}
+
+	for name, index := range methodQueryArgs {
+		f.methods[name] = index
+	}
+	for name, index := range methods {
+		f.methods[name] = index
+		f.anyReceiver[name] = struct{}{}
+	}
+	for _, name := range append(append(append([]string{}, handleTypes...), handleInterfaces...), receivers...) {
+		f.receivers[name] = f.methods
+	}
+	for _, name := range pgxHandleTypes {
+		f.receivers[name] = pgxMethodQueryArgs
+	}
+	f.receivers["github.com/jackc/pgx/v5.Batch"] = pgxBatchMethodQueryArgs
+	f.receivers[gormDB] = gormMethodQueryArgs
+
+	f.names = map[string]struct{}{}
+	for _, methods := range f.receivers {
+		for name := range methods {
+			f.names[name] = struct{}{}
+		}
+	}
+
+	return f
+}
+
+// scan collects the queries of the package resolving the constants
+// defined in it
+func (f *queryFinder) scan(p *packages.Package) error {
+	astPackage, err := AST(p)
+	if err != nil {
+		return fmt.Errorf("failed to load package sources: %v", err)
+	}
+
+	dir, err := Dir(p)
+	if err != nil {
+		return err
+	}
+
+	goFiles := make(map[string]struct{}, len(p.GoFiles))
+	for _, name := range p.GoFiles {
+		goFiles[name] = struct{}{}
+	}
+	if f.verbose {
+		f.logCgoIgnored(p.IgnoredFiles)
+	}
+
+	var files []*ast.File
+	skipped := map[string]struct{}{}
+	for _, file := range sortedFiles(astPackage) {
+		fileName := f.fs.Position(file.Package).Filename
+		reason := cgoReason(goFiles, f.fs.PositionFor(file.Package, false).Filename, fileName)
+		if reason == "" {
+			reason = f.skipReason(dir, fileName, file)
+		}
+		if reason != "" {
+			if _, ok := f.skippedFiles[fileName]; !ok && f.verbose {
+				log.Printf("prep: %s: skipped, %s", fileName, reason)
+			}
+			f.skippedFiles[fileName] = struct{}{}
+			skipped[fileName] = struct{}{}
+			continue
+		}
+		files = append(files, file)
+	}
+
+	f.info, f.pkg, f.skipped = p.TypesInfo, p.Types, skipped
+	f.handles = receiverTypes(p.Types, f.receivers)
+	f.constVars, f.varChanges = constantVars(files, sortedFiles(astPackage), p.TypesInfo)
+	embedded, err := f.embeddedVars(files, dir)
+	if err != nil {
+		return err
+	}
+	changed := changedVars(sortedFiles(astPackage), p.TypesInfo)
+	for obj, value := range embedded {
+		if _, ok := changed[obj]; !ok {
+			f.constVars[obj] = value
+		}
+	}
+	f.containers = queryContainers(files, sortedFiles(astPackage), p.TypesInfo)
+	f.rangeVars = rangeVars(files, p.TypesInfo, f.containers)
+	f.assigned = assignedVars(sortedFiles(astPackage), p.TypesInfo)
+
+	f.noValidate = map[types.Object]struct{}{}
+	for _, file := range files {
+		for _, name := range noValidateConsts(file) {
+			f.noValidate[p.TypesInfo.Defs[name]] = struct{}{}
+		}
+	}
+
+	f.ignored = nil
+	var forced []ast.Node
+	for _, file := range files {
+		for _, node := range annotatedNodes(f.fs, file, ignoreDirective) {
+			f.ignored = append(f.ignored, nodeRange{node.Pos(), node.End()})
+		}
+		forced = append(forced, annotatedNodes(f.fs, file, queryDirective)...)
+	}
+	for _, node := range forced {
+		f.forceQueries(node)
+	}
+
+	f.params = functionParams(files, p.TypesInfo)
+	f.methodValues = methodValues(files, p.TypesInfo, changed)
+	f.collectInCalls(files)
+	f.inits = varInits(files, p.TypesInfo)
+	f.changed = changed
+	f.sinks = map[*types.Func][]int{}
+	f.wrapperPass = false
+	for _, file := range files {
+		ast.Walk(f, file)
+	}
+
+	if len(f.sinks) > 0 {
+		f.wrapperPass = true
+		for _, file := range files {
+			ast.Walk(wrapperVisitor{f}, file)
+		}
+	}
+
+	return nil
+}
+
+// constantVars returns the values of the variables of the files
+// initialized to a string constant expression and never assigned to or
+// addressed in any of the files of the package, the package variables
+// must be unexported, and the positions the other such variables are
+// changed at
+func constantVars(files, packageFiles []*ast.File, info *types.Info) (map[types.Object]string, map[types.Object][]token.Pos) {
+	values := map[types.Object]string{}
+	define := func(name *ast.Ident, value ast.Expr) {
+		obj := info.Defs[name]
+		if obj == nil || (name.IsExported() && obj.Parent() == obj.Pkg().Scope()) {
+			return
+		}
+		if tv, ok := info.Types[value]; ok && tv.Value != nil && tv.Value.Kind() == constant.String {
+			values[obj] = tv.Value.ExactString()
+		}
+	}
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.ValueSpec:
+				if len(n.Values) == len(n.Names) {
+					for i, name := range n.Names {
+						define(name, n.Values[i])
+					}
+				}
+			case *ast.AssignStmt:
+				if n.Tok == token.DEFINE && len(n.Lhs) == len(n.Rhs) {
+					for i, lhs := range n.Lhs {
+						if ident, ok := lhs.(*ast.Ident); ok {
+							define(ident, n.Rhs[i])
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	// the variables changed anywhere aren't constant, the redeclared
+	// variables of the short variable declarations are uses
+	changes := map[types.Object][]token.Pos{}
+	changed := func(expr ast.Expr, pos token.Pos) {
+		for paren, ok := expr.(*ast.ParenExpr); ok; paren, ok = expr.(*ast.ParenExpr) {
+			expr = paren.X
+		}
+		ident, ok := expr.(*ast.Ident)
+		if !ok {
+			return
+		}
+		obj := info.Uses[ident]
+		if _, ok := values[obj]; ok || changes[obj] != nil {
+			delete(values, obj)
+			changes[obj] = append(changes[obj], pos)
+		}
+	}
+	for _, file := range packageFiles {
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.AssignStmt:
+				for _, lhs := range n.Lhs {
+					changed(lhs, n.Pos())
+				}
+			case *ast.UnaryExpr:
+				if n.Op == token.AND {
+					changed(n.X, n.Pos())
+				}
+			}
+			return true
+		})
+	}
+
+	return values, changes
+}
+
+// noValidateDirective excludes the query of the constant from -validate
+const noValidateDirective = "//prep:novalidate"
+
+// noValidateConsts returns the names of the constants of the file
+// which declarations or specs carry the //prep:novalidate comment
+func noValidateConsts(file *ast.File) []*ast.Ident {
+	var names []*ast.Ident
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.CONST {
+			continue
+		}
+
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if !hasDirective(noValidateDirective, gen.Doc, vs.Doc, vs.Comment) {
+				continue
+			}
+			names = append(names, vs.Names...)
+		}
+	}
+	return names
+}
+
+// hasDirective reports whether any of the comment groups holds the
+// directive comment
+func hasDirective(directive string, groups ...*ast.CommentGroup) bool {
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		for _, c := range group.List {
+			if strings.TrimSpace(c.Text) == directive {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cgoReason returns the reason the compiled file of the package is
+// skipped if it is produced by cgo, either from a Go file of the package
+// using cgo, which line directives map to it, or as one of the pseudo
+// files of the cgo declarations, an empty string otherwise
+func cgoReason(goFiles map[string]struct{}, compiled, fileName string) string {
+	if _, ok := goFiles[compiled]; ok || len(goFiles) == 0 {
+		return ""
+	}
+	if _, ok := goFiles[fileName]; ok {
+		return "uses cgo, the files processed by cgo are not scanned"
+	}
+	return "cgo pseudo file"
+}
+
+// logCgoIgnored logs the ignored files of the package importing C, the
+// go command leaves them out if cgo is disabled, for one
+func (f *queryFinder) logCgoIgnored(ignored []string) {
+	for _, name := range ignored {
+		if _, ok := f.skippedFiles[name]; ok || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), name, nil, parser.ImportsOnly)
+		if err != nil {
+			continue
+		}
+		for _, spec := range file.Imports {
+			if spec.Path.Value == `"C"` {
+				f.skippedFiles[name] = struct{}{}
+				log.Printf("prep: %s: skipped, uses cgo and is left out of the build, i.e. cgo is disabled", name)
+				break
+			}
+		}
+	}
+}
+
+// skipReason returns the reason the file of the package located in dir
+// must not be scanned or an empty string if it must be scanned
+func (f *queryFinder) skipReason(dir, fileName string, file *ast.File) string {
+	for _, generated := range f.generatedFiles {
+		if fileName == generated {
+			return "previously generated file"
+		}
+	}
+
+	if !f.includeGenerated && isGenerated(file) {
+		return "Code generated file"
+	}
+
+	rel, err := filepath.Rel(dir, fileName)
+	if err != nil {
+		rel = fileName
+	}
+
+	for _, pattern := range f.exclude {
+		if ok, _ := filepath.Match(pattern, filepath.Base(fileName)); ok {
+			return fmt.Sprintf("matches -exclude %s", pattern)
+		}
+		if ok, _ := filepath.Match(pattern, filepath.ToSlash(rel)); ok {
+			return fmt.Sprintf("matches -exclude %s", pattern)
+		}
+	}
+
+	return ""
+}
+
+// generatedHeader matches the comment marking the generated files,
+// see go help generate
+var generatedHeader = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// isGenerated reports whether the file carries the Code generated
+// comment before its package clause
+func isGenerated(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			return false
+		}
+		for _, c := range group.List {
+			if generatedHeader.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// maps method name to the index of its query argument, the variants
+// without the context take the query one argument earlier
+var methodQueryArgs = map[string]int{
+	"ExecContext":         1,
+	"QueryContext":        1,
+	"QueryRowContext":     1,
+	"NamedExecContext":    1,
+	"GetContext":          2,
+	"SelectContext":       2,
+	"NamedQueryContext":   1,
+	"PrepareContext":      1,
+	"PrepareNamedContext": 1,
+	"QueryxContext":       1,
+	"QueryRowxContext":    1,
+	"MustExecContext":     1,
+	"PreparexContext":     1,
+
+	"Exec":         0,
+	"Query":        0,
+	"QueryRow":     0,
+	"NamedExec":    0,
+	"Get":          1,
+	"Select":       1,
+	"NamedQuery":   0,
+	"Prepare":      0,
+	"PrepareNamed": 0,
+	"Queryx":       0,
+	"QueryRowx":    0,
+	"MustExec":     0,
+	"Preparex":     0,
+}
+
+// sqlxPath is the import path of the sqlx package
+const sqlxPath = "github.com/jmoiron/sqlx"
+
+// maps the functions of the sqlx package to the indexes of their query
+// arguments
+var sqlxFunctionQueryArgs = map[string]int{
+	"GetContext":        3,
+	"SelectContext":     3,
+	"NamedExecContext":  2,
+	"NamedQueryContext": 2,
+	"Get":               2,
+	"Select":            2,
+	"NamedExec":         1,
+	"NamedQuery":        1,
+	"In":                0,
+}
+
+// sqlxFunction returns the index of the query argument if the function
+// expression refers to a function of the sqlx package, whatever name
+// it is imported as, dot imports included
+func (f *queryFinder) sqlxFunction(fun ast.Expr) (int, bool) {
+	ident := funcIdent(fun)
+	if ident == nil {
+		return 0, false
+	}
+
+	fn, ok := f.info.Uses[ident].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != sqlxPath || fn.Type().(*types.Signature).Recv() != nil {
+		return 0, false
+	}
+
+	index, ok := sqlxFunctionQueryArgs[fn.Name()]
+	return index, ok
+}
+
+// funcIdent returns the identifier naming the function or the method
+// of the function expression, the instantiations of the generic ones
+// included, nil if it is neither an identifier nor a selector
+func funcIdent(fun ast.Expr) *ast.Ident {
+	switch fun := fun.(type) {
+	case *ast.Ident:
+		return fun
+	case *ast.SelectorExpr:
+		return fun.Sel
+	case *ast.IndexExpr:
+		return funcIdent(fun.X)
+	case *ast.IndexListExpr:
+		return funcIdent(fun.X)
+	}
+	return nil
+}
+
+// handleTypes are the import path qualified names of the database
+// handle types matched by the database/sql methods
+var handleTypes = []string{
+	"database/sql.DB",
+	"database/sql.Tx",
+	"database/sql.Conn",
+	"github.com/jmoiron/sqlx.DB",
+	"github.com/jmoiron/sqlx.Tx",
+	"github.com/jmoiron/sqlx.Conn",
+}
+
+// handleInterfaces are the import path qualified names of the
+// interfaces of the database handles, the interfaces declared by the
+// packages are matched if any of the handles or of these implements them
+var handleInterfaces = []string{
+	"github.com/jmoiron/sqlx.Queryer",
+	"github.com/jmoiron/sqlx.QueryerContext",
+	"github.com/jmoiron/sqlx.Execer",
+	"github.com/jmoiron/sqlx.ExecerContext",
+	"github.com/jmoiron/sqlx.Ext",
+	"github.com/jmoiron/sqlx.ExtContext",
+	"github.com/jmoiron/sqlx.Preparer",
+	"github.com/jmoiron/sqlx.PreparerContext",
+}
+
+// statementTypes are the import path qualified names of the prepared
+// statement types, their methods take the arguments only
+var statementTypes = map[string]struct{}{
+	"database/sql.Stmt":                 {},
+	"github.com/jmoiron/sqlx.Stmt":      {},
+	"github.com/jmoiron/sqlx.NamedStmt": {},
+}
+
+// pgxHandleTypes are the import path qualified names of the pgx handle
+// types
+var pgxHandleTypes = []string{
+	"github.com/jackc/pgx/v5.Conn",
+	"github.com/jackc/pgx/v5.Tx",
+	"github.com/jackc/pgx/v5/pgxpool.Pool",
+	"github.com/jackc/pgx/v5/pgxpool.Conn",
+	"github.com/jackc/pgx/v5/pgxpool.Tx",
+}
+
+// maps the methods of the pgx handles to the indexes of their query
+// arguments, all of them take the context first
+var pgxMethodQueryArgs = map[string]int{
+	"Exec":     1,
+	"Query":    1,
+	"QueryRow": 1,
+	"Prepare":  2,
+}
+
+// maps the methods of the pgx batch to the indexes of their query
+// arguments
+var pgxBatchMethodQueryArgs = map[string]int{
+	"Queue": 0,
+}
+
+// gormDB is the import path qualified name of the gorm handle
+const gormDB = "gorm.io/gorm.DB"
+
+// maps the raw SQL methods of the gorm handle to the indexes of their
+// query arguments, the queries built by the clause builders and the
+// chained methods aren't raw SQL and aren't matched
+var gormMethodQueryArgs = map[string]int{
+	"Raw":  0,
+	"Exec": 0,
+}
+
+// receiverTypes returns the handles of the named types of the package
+// and of all of its imports which qualified names are receivers
+func receiverTypes(p *types.Package, receivers map[string]map[string]int) []handle {
+	var found []handle
+	seen := map[*types.Package]struct{}{}
+	var walk func(p *types.Package)
+	walk = func(p *types.Package) {
+		if _, ok := seen[p]; ok {
+			return
+		}
+		seen[p] = struct{}{}
+
+		for _, name := range p.Scope().Names() {
+			methods, ok := receivers[p.Path()+"."+name]
+			if !ok {
+				continue
+			}
+			if typeName, ok := p.Scope().Lookup(name).(*types.TypeName); ok {
+				found = append(found, handle{typeName.Type(), methods})
+			}
+		}
+		for _, imported := range p.Imports() {
+			walk(imported)
+		}
+	}
+	walk(p)
+
+	return found
+}
+
+// checkReceivers returns an error if any of the receivers isn't a named
+// type of the import graph of the packages, the error lists the types
+// the package of the receiver declares or, if no package imports it,
+// the types of the same name found in the graph, the receivers which
+// packages aren't imported are accepted unless required is set
+func checkReceivers(pkgs []*types.Package, receivers []string, required bool) error {
+	graph := map[string]*types.Package{}
+	var walk func(p *types.Package)
+	walk = func(p *types.Package) {
+		if _, ok := graph[p.Path()]; ok {
+			return
+		}
+		graph[p.Path()] = p
+		for _, imported := range p.Imports() {
+			walk(imported)
+		}
+	}
+	for _, p := range pkgs {
+		walk(p)
+	}
+
+	for _, receiver := range receivers {
+		dot := strings.LastIndex(receiver, ".")
+		path, name := receiver[:dot], receiver[dot+1:]
+
+		if p, ok := graph[path]; ok {
+			if _, ok := p.Scope().Lookup(name).(*types.TypeName); ok {
+				continue
+			}
+
+			var names []string
+			for _, n := range p.Scope().Names() {
+				if _, ok := p.Scope().Lookup(n).(*types.TypeName); ok && token.IsExported(n) {
+					names = append(names, path+"."+n)
+				}
+			}
+			return fmt.Errorf("-receiver %s: %s declares no type %s, its types are %s", receiver, path, name, listOrNone(names))
+		}
+
+		if !required {
+			continue
+		}
+
+		var found []string
+		for _, p := range graph {
+			for _, n := range p.Scope().Names() {
+				if _, ok := p.Scope().Lookup(n).(*types.TypeName); ok && strings.EqualFold(n, name) {
+					found = append(found, p.Path()+"."+n)
+				}
+			}
+		}
+		sort.Strings(found)
+		return fmt.Errorf("-receiver %s: %s isn't imported by the source packages, the types named %s found are %s", receiver, path, name, listOrNone(found))
+	}
+	return nil
+}
+
+// listOrNone returns the comma separated names, none if there are none
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// methodQueryArg returns the index of the query argument of the method
+// called by the selector, matched is false if no method matcher has the
+// name of the method, the index is negative if the method is not called
+// on a database handle
+func (f *queryFinder) methodQueryArg(selector *ast.SelectorExpr) (index int, matched bool) {
+	name := selector.Sel.Name
+	if _, ok := f.anyReceiver[name]; ok {
+		if index := f.methods[name]; index != autoIndex {
+			return index, true
+		}
+		return f.detectQueryArg(selector)
+	}
+
+	if _, ok := f.names[name]; !ok {
+		return 0, false
+	}
+
+	methods := f.receiverMethods(selector)
+	if index, ok := methods[name]; ok {
+		return index, true
+	}
+	return -1, true
+}
+
+// autoIndex is the argument index of the method matchers detecting the
+// index of the query argument from the signature of the method
+const autoIndex = -1
+
+// detectQueryArg returns the index of the query parameter of the method
+// called by the selector, matched is false if the method has none or if
+// several parameters may be the query, which is reported once
+func (f *queryFinder) detectQueryArg(selector *ast.SelectorExpr) (index int, matched bool) {
+	fn, ok := f.info.Uses[selector.Sel].(*types.Func)
+	if !ok {
+		return 0, false
+	}
+
+	sig := fn.Type().(*types.Signature)
+	index, ambiguous := queryParamIndex(sig)
+	if ambiguous {
+		key := "ambiguous " + fn.FullName()
+		if _, ok := f.suggested[key]; !ok {
+			f.suggested[key] = struct{}{}
+			f.warnf(selector, "%s: skipped, several string parameters of %s may be the query, use -method %s:argIndex", fn.Name(), types.TypeString(sig, nil), fn.Name())
+		}
+		return 0, false
+	}
+	return index, index >= 0
+}
+
+// queryParamIndex returns the index of the first parameter of the string
+// type, a named one included, following an optional leading context,
+// negative if there is none, ambiguous is set if several parameters
+// are strings
+func queryParamIndex(sig *types.Signature) (index int, ambiguous bool) {
+	params := sig.Params()
+	start := 0
+	if params.Len() > 0 && isContext(params.At(0).Type()) {
+		start = 1
+	}
+
+	index = -1
+	for i := start; i < params.Len(); i++ {
+		if sig.Variadic() && i == params.Len()-1 {
+			break
+		}
+		basic, ok := params.At(i).Type().Underlying().(*types.Basic)
+		if !ok || basic.Kind() != types.String {
+			continue
+		}
+		if index >= 0 {
+			return index, true
+		}
+		index = i
+	}
+	return index, false
+}
+
+// isContext reports whether the type is context.Context
+func isContext(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context"
+}
+
+// suggestReceiver warns once about the method of a type declared by
+// another package which takes a string at the index of the query
+// argument of the method matcher of the same name, the method likely
+// forwards to a database handle and its type can be made a receiver
+func (f *queryFinder) suggestReceiver(fCall *ast.CallExpr, selector *ast.SelectorExpr) {
+	selection, ok := f.info.Selections[selector]
+	if !ok || selection.Kind() != types.MethodVal {
+		return
+	}
+
+	fn := selection.Obj().(*types.Func)
+	if fn.Pkg() == nil || fn.Pkg() == f.pkg {
+		// the wrappers of the package are followed
+		return
+	}
+
+	receiver := f.receiverName(selector)
+	if receiver == "" {
+		return
+	}
+
+	index, ok := f.methods[fn.Name()]
+	if !ok {
+		index = pgxMethodQueryArgs[fn.Name()]
+	}
+	params := fn.Type().(*types.Signature).Params()
+	if index < 0 || index >= params.Len() {
+		return
+	}
+	if basic, ok := params.At(index).Type().Underlying().(*types.Basic); !ok || basic.Kind() != types.String {
+		return
+	}
+
+	key := receiver + "." + fn.Name()
+	if _, ok := f.suggested[key]; ok {
+		return
+	}
+	f.suggested[key] = struct{}{}
+	f.warnf(fCall, "%s: %s.%s looks like a query method, use -receiver %s to match it", fn.Name(), receiver[strings.LastIndex(receiver, "/")+1:], fn.Name(), receiver)
+}
+
+// receiverName returns the import path qualified name of the type
+// declaring the method called by the selector, an empty string if the
+// type is not a named type of a package
+func (f *queryFinder) receiverName(selector *ast.SelectorExpr) string {
+	selection, ok := f.info.Selections[selector]
+	if !ok || selection.Kind() != types.MethodVal {
+		return ""
+	}
+
+	recv := selection.Obj().(*types.Func).Type().(*types.Signature).Recv().Type()
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = ptr.Elem()
+	}
+	named, ok := recv.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return ""
+	}
+	return named.Obj().Pkg().Path() + "." + named.Obj().Name()
+}
+
+// receiverMethods returns the method matchers of the receiver of the
+// method called by the selector if it is a database handle, a type
+// embedding one, one of the receivers or an interface any of them
+// implements, nil otherwise
+func (f *queryFinder) receiverMethods(selector *ast.SelectorExpr) map[string]int {
+	selection, ok := f.info.Selections[selector]
+	if !ok || selection.Kind() != types.MethodVal {
+		// a function of an imported package or a method expression
+		return nil
+	}
+
+	// the receiver of a method promoted through any depth of embedded
+	// fields, including the embedded interfaces, is the type declaring
+	// it, the field chains of the selector are resolved by its type
+	recv := selection.Obj().(*types.Func).Type().(*types.Signature).Recv().Type()
+	if ptr, ok := recv.(*types.Pointer); ok {
+		recv = ptr.Elem()
+	}
+
+	if named, ok := recv.(*types.Named); ok && named.Obj().Pkg() != nil {
+		if methods, ok := f.receivers[named.Obj().Pkg().Path()+"."+named.Obj().Name()]; ok {
+			return methods
+		}
+	}
+
+	iface, ok := recv.Underlying().(*types.Interface)
+	if !ok {
+		return nil
+	}
+	for _, h := range f.handles {
+		if types.Implements(h.typ, iface) || types.Implements(types.NewPointer(h.typ), iface) {
+			return h.methods
+		}
+	}
+	return nil
+}
+
+// Visit implements ast.Visitor interface
+func (f *queryFinder) Visit(node ast.Node) ast.Visitor {
+	fCall, ok := node.(*ast.CallExpr)
+	if !ok {
+		return f
+	}
+
+	var method string
+	argIndex, ok := f.sqlxFunction(fCall.Fun)
+	if ok {
+		method = "sqlx." + funcIdent(fCall.Fun).Name
+	} else {
+		f.methodValueArgs(fCall)
+
+		selector, ok := f.calledSelector(fCall.Fun)
+		if !ok {
+			return f
+		}
+
+		method = selector.Sel.Name
+		if argIndex, ok = f.methodQueryArg(selector); !ok {
+			return f
+		}
+
+		if argIndex < 0 {
+			// the queries of the statements are extracted where they
+			// are prepared
+			if _, ok := statementTypes[f.receiverName(selector)]; ok {
+				f.logf(fCall, "%s: skipped, executes a prepared statement", method)
+				return f
+			}
+
+			f.logf(fCall, "%s: skipped, not called on a database handle", method)
+			f.suggestReceiver(fCall, selector)
+			return f
+		}
+	}
+
+	// the links of a chain and the arguments may be matched calls too
+	pos := f.fs.Position(fCall.Pos())
+	if _, ok := f.seen[pos]; ok {
+		return f
+	}
+	f.seen[pos] = struct{}{}
+
+	if argIndex >= len(fCall.Args) {
+		f.warnf(fCall, "%s: skipped, no query argument at index %d", method, argIndex)
+		f.record(callSite{Pos: pos, Method: method, Status: siteOdd,
+			Reason: fmt.Sprintf("no query argument at index %d", argIndex)})
+		return f
+	}
+
+	f.extract(fCall, pos, method, fCall.Args[argIndex])
+	return f
+}
+
+// extract records the query of the matched call given by the argument
+func (f *queryFinder) extract(fCall *ast.CallExpr, pos token.Position, method string, queryArg ast.Expr) {
+	if f.ignoredAt(fCall.Pos()) || f.ignoredConst(queryArg) {
+		f.logf(fCall, "%s: suppressed by %s", method, ignoreDirective)
+		f.addSite(pos, method, siteIgnored, "", queryArg, "suppressed by "+ignoreDirective)
+		return
+	}
+
+	if p, ok := f.parameterOf(queryArg); ok {
+		if f.wrapperPass {
+			f.warnf(fCall, "%s: unresolved, %s is a parameter of %s, wrappers of wrappers are not followed", method, types.ExprString(queryArg), p.fn.Name())
+			f.addSite(pos, method, siteDynamic, "", queryArg, "a parameter of "+p.fn.Name())
+			return
+		}
+
+		// the queries are extracted at the calls of the wrapper
+		if !slices.Contains(f.sinks[p.fn], p.index) {
+			f.sinks[p.fn] = append(f.sinks[p.fn], p.index)
+		}
+		f.logf(fCall, "%s: forwarded, %s is a parameter of %s", method, types.ExprString(queryArg), p.fn.Name())
+		return
+	}
+
+	elements, reason := f.containerElements(queryArg)
+	if reason != "" {
+		f.logf(fCall, "%s: unresolved, %s is %s", method, types.ExprString(queryArg), reason)
+		f.addSite(pos, method, siteDynamic, "", queryArg, reason)
+		return
+	}
+	if len(elements) > 0 {
+		resolved := 0
+		for _, element := range elements {
+			// the constants of the files which aren't scanned have no
+			// value, the generated code indexes the statements by
+			// their order and must not hold them
+			value, name := f.processQuery(element)
+			if value == "" {
+				f.warnf(element, "%s: element %s of %s is left out, it's declared by a file which isn't scanned", method, types.ExprString(element), types.ExprString(queryArg))
+				continue
+			}
+			obj := f.constOf(element)
+			_, noValidate := f.noValidate[obj]
+			f.queries = append(f.queries, query{Value: value, Name: name, File: f.declFile(obj), Pos: []token.Position{pos}, NoValidate: noValidate})
+			resolved++
+		}
+		if resolved == 0 {
+			f.addSite(pos, method, siteDynamic, "", queryArg, "no element declared by a scanned file")
+			return
+		}
+		f.addSite(pos, method, siteExtracted, "", queryArg, "")
+		f.logf(fCall, "%s: resolved %d queries of %s", method, resolved, types.ExprString(queryArg))
+		return
+	}
+
+	value, name := f.processQuery(queryArg)
+
+	switch {
+	case value != "":
+		obj := f.constOf(queryArg)
+		_, noValidate := f.noValidate[obj]
+		f.queries = append(f.queries, query{Value: value, Name: name, File: f.declFile(obj), Pos: []token.Position{pos}, NoValidate: noValidate})
+		f.addSite(pos, method, siteExtracted, name, queryArg, "")
+		f.logf(fCall, "%s: resolved", method)
+	case f.inExpansion(queryArg) != nil:
+		in := f.fs.Position(f.inExpansion(queryArg).Pos())
+		reason := fmt.Sprintf("expanded by sqlx.In at %s:%d", in.Filename, in.Line)
+		f.logf(fCall, "%s: resolved, %s is %s", method, types.ExprString(queryArg), reason)
+		f.addSite(pos, method, siteExtracted, "", queryArg, reason)
+	case f.builtBy(queryArg) != "":
+		reason := f.builtBy(queryArg)
+		f.logf(fCall, "%s: unresolved, %s is %s", method, types.ExprString(queryArg), reason)
+		f.addSite(pos, method, siteDynamic, "", queryArg, reason)
+	case f.isSprint(queryArg):
+		reason := "dynamically formatted query"
+		if format := f.sprintfFormat(queryArg); format != "" {
+			reason += " " + format
+			f.templates = append(f.templates, query{Value: format, Pos: []token.Position{pos}})
+		}
+		f.logf(fCall, "%s: unresolved, %s", method, reason)
+		f.addSite(pos, method, siteDynamic, "", queryArg, reason)
+	case f.isVar(queryArg):
+		reason := "a variable, not a constant"
+		if changes := f.changesOf(queryArg); changes != "" {
+			reason = "a variable changed at " + changes
+		}
+		f.logf(fCall, "%s: unresolved, %s is %s", method, types.ExprString(queryArg), reason)
+		f.addSite(pos, method, siteDynamic, "", queryArg, reason)
+	case isConcatenation(queryArg):
+		f.warnf(fCall, "%s: unresolved, %s is not a constant expression", method, types.ExprString(queryArg))
+		f.addSite(pos, method, siteDynamic, "", queryArg, "not a constant expression")
+	case isIdent(queryArg) || isSelector(queryArg):
+		f.logf(fCall, "%s: unresolved, %s is not a known constant", method, types.ExprString(queryArg))
+		f.addSite(pos, method, siteDynamic, "", queryArg, "not a known constant")
+	default:
+		f.logf(fCall, "%s: skipped, query is neither a string literal nor a constant", method)
+		f.addSite(pos, method, siteDynamic, "", queryArg, "neither a string literal nor a constant")
+	}
+}
+
+// parameterOf returns the parameter of the function declared by the
+// package the query argument refers to, the parameter must not be
+// changed in the function
+func (f *queryFinder) parameterOf(queryArg ast.Expr) (parameter, bool) {
+	ident, ok := queryArg.(*ast.Ident)
+	if !ok {
+		return parameter{}, false
+	}
+
+	obj := f.info.Uses[ident]
+	p, ok := f.params[obj]
+	if !ok {
+		return parameter{}, false
+	}
+	if _, changed := f.changed[obj]; changed {
+		return parameter{}, false
+	}
+	return p, true
+}
+
+// methodValues returns the method value selectors the variables of the
+// files are initialized to, the changed variables are left out
+func methodValues(files []*ast.File, info *types.Info, changed map[types.Object]struct{}) map[types.Object]*ast.SelectorExpr {
+	values := map[types.Object]*ast.SelectorExpr{}
+	add := func(name *ast.Ident, value ast.Expr) {
+		selector, ok := value.(*ast.SelectorExpr)
+		if !ok || info.Defs[name] == nil {
+			return
+		}
+		if selection, ok := info.Selections[selector]; ok && selection.Kind() == types.MethodVal {
+			values[info.Defs[name]] = selector
+		}
+	}
+
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.AssignStmt:
+				if n.Tok != token.DEFINE || len(n.Lhs) != len(n.Rhs) {
+					return true
+				}
+				for i, lhs := range n.Lhs {
+					if name, ok := lhs.(*ast.Ident); ok {
+						add(name, n.Rhs[i])
+					}
+				}
+			case *ast.ValueSpec:
+				if len(n.Names) != len(n.Values) {
+					return true
+				}
+				for i, name := range n.Names {
+					add(name, n.Values[i])
+				}
+			}
+			return true
+		})
+	}
+
+	for obj := range changed {
+		delete(values, obj)
+	}
+	return values
+}
+
+// collectInCalls collects the sqlx.In calls the variables of the files
+// are assigned the expanded query of, possibly rebound, in the order of
+// the assignments
+func (f *queryFinder) collectInCalls(files []*ast.File) {
+	f.inCalls = map[types.Object]*ast.CallExpr{}
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			assign, ok := node.(*ast.AssignStmt)
+			if !ok || len(assign.Rhs) != 1 {
+				return true
+			}
+			name, ok := assign.Lhs[0].(*ast.Ident)
+			if !ok {
+				return true
+			}
+			obj := f.info.Defs[name]
+			if obj == nil {
+				obj = f.info.Uses[name]
+			}
+
+			call, ok := assign.Rhs[0].(*ast.CallExpr)
+			switch {
+			case !ok || obj == nil:
+			case f.isIn(call) && len(assign.Lhs) == 3:
+				f.inCalls[obj] = call
+			case len(assign.Lhs) == 1:
+				if in := f.inExpansion(call); in != nil {
+					f.inCalls[obj] = in
+				}
+			}
+			return true
+		})
+	}
+}
+
+// builtBy returns the reason the query argument is built at run time
+// by a strings.Builder or strings.Join, either directly, concatenated
+// or through the variable initialized to it, an empty string if it
+// isn't
+func (f *queryFinder) builtBy(queryArg ast.Expr) string {
+	switch q := queryArg.(type) {
+	case *ast.Ident:
+		if value, ok := f.inits[f.info.Uses[q]]; ok {
+			return f.builtBy(value)
+		}
+		return ""
+	case *ast.ParenExpr:
+		return f.builtBy(q.X)
+	case *ast.BinaryExpr:
+		if reason := f.builtBy(q.X); reason != "" {
+			return reason
+		}
+		return f.builtBy(q.Y)
+	}
+
+	call, ok := queryArg.(*ast.CallExpr)
+	if !ok {
+		return ""
+	}
+	ident := funcIdent(call.Fun)
+	if ident == nil {
+		return ""
+	}
+	fn, ok := f.info.Uses[ident].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != "strings" {
+		return ""
+	}
+
+	switch fn.Name() {
+	case "Join":
+		if fn.Type().(*types.Signature).Recv() == nil {
+			pos := f.fs.Position(call.Pos())
+			return fmt.Sprintf("joined by strings.Join at %s:%d", filepath.Base(pos.Filename), pos.Line)
+		}
+	case "String":
+		selector, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || f.receiverName(selector) != "strings.Builder" {
+			return ""
+		}
+		reason := "built by a strings.Builder"
+		if x, ok := selector.X.(*ast.Ident); ok {
+			if obj := f.info.Uses[x]; obj != nil {
+				pos := f.fs.Position(obj.Pos())
+				reason += fmt.Sprintf(" declared at %s:%d", filepath.Base(pos.Filename), pos.Line)
+			}
+		}
+		return reason
+	}
+	return ""
+}
+
+// varInits returns the values the local variables of the files are
+// initialized to, the variables changed later are kept
+func varInits(files []*ast.File, info *types.Info) map[types.Object]ast.Expr {
+	inits := map[types.Object]ast.Expr{}
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			switch n := node.(type) {
+			case *ast.AssignStmt:
+				if n.Tok != token.DEFINE || len(n.Lhs) != len(n.Rhs) {
+					return true
+				}
+				for i, lhs := range n.Lhs {
+					if ident, ok := lhs.(*ast.Ident); ok && info.Defs[ident] != nil {
+						inits[info.Defs[ident]] = n.Rhs[i]
+					}
+				}
+			case *ast.ValueSpec:
+				if len(n.Names) != len(n.Values) {
+					return true
+				}
+				for i, name := range n.Names {
+					if obj := info.Defs[name]; obj != nil && obj.Parent() != obj.Pkg().Scope() {
+						inits[obj] = n.Values[i]
+					}
+				}
+			}
+			return true
+		})
+	}
+	return inits
+}
+
+// sprintFunctions are the functions of the fmt package formatting the
+// queries at run time
+var sprintFunctions = map[string]struct{}{
+	"Sprintf":  {},
+	"Sprint":   {},
+	"Sprintln": {},
+}
+
+// isSprint reports whether the query argument is formatted by one of
+// the sprint functions of the fmt package
+func (f *queryFinder) isSprint(queryArg ast.Expr) bool {
+	call, ok := queryArg.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	ident := funcIdent(call.Fun)
+	if ident == nil {
+		return false
+	}
+	fn, ok := f.info.Uses[ident].(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != "fmt" {
+		return false
+	}
+	_, ok = sprintFunctions[fn.Name()]
+	return ok
+}
+
+// sprintfFormat returns the Go literal of the constant format string of
+// the fmt.Sprintf call, an empty string if it isn't constant
+func (f *queryFinder) sprintfFormat(queryArg ast.Expr) string {
+	call := queryArg.(*ast.CallExpr)
+	if funcIdent(call.Fun).Name != "Sprintf" || len(call.Args) == 0 {
+		return ""
+	}
+	if tv, ok := f.info.Types[call.Args[0]]; ok && tv.Value != nil && tv.Value.Kind() == constant.String {
+		return tv.Value.ExactString()
+	}
+	return ""
+}
+
+// isIn reports whether the call is a call of sqlx.In
+func (f *queryFinder) isIn(call *ast.CallExpr) bool {
+	ident := funcIdent(call.Fun)
+	if ident == nil {
+		return false
+	}
+	fn, ok := f.info.Uses[ident].(*types.Func)
+	return ok && fn.Pkg() != nil && fn.Pkg().Path() == sqlxPath && fn.Name() == "In"
+}
+
+// inExpansion returns the sqlx.In call expanding the query argument,
+// a variable assigned its query, possibly passed through Rebind, nil if
+// the argument isn't expanded by sqlx.In
+func (f *queryFinder) inExpansion(queryArg ast.Expr) *ast.CallExpr {
+	if call, ok := queryArg.(*ast.CallExpr); ok {
+		if selector, ok := call.Fun.(*ast.SelectorExpr); ok && selector.Sel.Name == "Rebind" && len(call.Args) == 1 {
+			return f.inExpansion(call.Args[0])
+		}
+		return nil
+	}
+
+	if ident, ok := queryArg.(*ast.Ident); ok {
+		return f.inCalls[f.info.Uses[ident]]
+	}
+	return nil
+}
+
+// calledSelector returns the selector of the method called by the
+// function expression, either directly or through a local variable
+// holding the method value
+func (f *queryFinder) calledSelector(fun ast.Expr) (*ast.SelectorExpr, bool) {
+	switch fun := fun.(type) {
+	case *ast.SelectorExpr:
+		return fun, true
+	case *ast.Ident:
+		selector, ok := f.methodValues[f.info.Uses[fun]]
+		return selector, ok
+	}
+	return nil, false
+}
+
+// methodValueArgs records the query methods of the database handles
+// passed as method values to the call as dynamic call sites, the
+// queries are passed to them by the callee
+func (f *queryFinder) methodValueArgs(fCall *ast.CallExpr) {
+	for _, arg := range fCall.Args {
+		selector, ok := arg.(*ast.SelectorExpr)
+		if !ok {
+			continue
+		}
+		if selection, ok := f.info.Selections[selector]; !ok || selection.Kind() != types.MethodVal {
+			continue
+		}
+		if index, ok := f.methodQueryArg(selector); !ok || index < 0 {
+			continue
+		}
+
+		pos := f.fs.Position(arg.Pos())
+		if _, ok := f.seen[pos]; ok {
+			continue
+		}
+		f.seen[pos] = struct{}{}
+
+		reason := "a method value passed to " + types.ExprString(fCall.Fun)
+		f.logf(arg, "%s: unresolved, %s", selector.Sel.Name, reason)
+		f.addSite(pos, selector.Sel.Name, siteDynamic, "", arg, reason)
+	}
+}
+
+// functionParams returns the query parameters of the functions and the
+// methods declared by the files, the variadic parameters are left out
+func functionParams(files []*ast.File, info *types.Info) map[types.Object]parameter {
+	params := map[types.Object]parameter{}
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+			fn, ok := info.Defs[fd.Name].(*types.Func)
+			if !ok {
+				continue
+			}
+
+			index := 0
+			for _, field := range fd.Type.Params.List {
+				_, variadic := field.Type.(*ast.Ellipsis)
+				for _, name := range field.Names {
+					if obj := info.Defs[name]; obj != nil && !variadic {
+						params[obj] = parameter{fn, index}
+					}
+					index++
+				}
+				if len(field.Names) == 0 {
+					index++
+				}
+			}
+		}
+	}
+	return params
+}
+
+// wrapperVisitor extracts the queries of the calls of the wrappers, the
+// functions passing their query parameter to a matched call
+type wrapperVisitor struct {
+	f *queryFinder
+}
+
+// Visit implements ast.Visitor interface
+func (v wrapperVisitor) Visit(node ast.Node) ast.Visitor {
+	f := v.f
+	fCall, ok := node.(*ast.CallExpr)
+	if !ok {
+		return v
+	}
+
+	ident := funcIdent(fCall.Fun)
+	if ident == nil {
+		return v
+	}
+
+	fn, ok := f.info.Uses[ident].(*types.Func)
+	if !ok {
+		return v
+	}
+	// the methods of the instantiated generic types are distinct
+	fn = fn.Origin()
+	argIndexes, ok := f.sinks[fn]
+	if !ok {
+		return v
+	}
+
+	pos := f.fs.Position(fCall.Pos())
+	if _, ok := f.seen[pos]; ok {
+		return v
+	}
+	f.seen[pos] = struct{}{}
+
+	for _, argIndex := range argIndexes {
+		if argIndex >= len(fCall.Args) {
+			// the arguments of a multi-valued call
+			f.warnf(fCall, "%s: skipped, no query argument at index %d", fn.Name(), argIndex)
+			f.record(callSite{Pos: pos, Method: fn.Name(), Status: siteOdd,
+				Reason: fmt.Sprintf("no query argument at index %d", argIndex)})
+			continue
+		}
+		f.extract(fCall, pos, fn.Name(), fCall.Args[argIndex])
+	}
+	return v
+}
+
+// addSite records the matched call with the given query argument
+func (f *queryFinder) addSite(pos token.Position, method string, status siteStatus, name string, queryArg ast.Expr, reason string) {
+	f.record(callSite{
+		Pos:    pos,
+		Method: method,
+		Status: status,
+		Name:   name,
+		Expr:   types.ExprString(queryArg),
+		Reason: reason,
+	})
+}
+
+// record appends the call site unless it is already recorded
+func (f *queryFinder) record(site callSite) {
+	if _, ok := f.recorded[site]; ok {
+		return
+	}
+	f.recorded[site] = struct{}{}
+	f.sites = append(f.sites, site)
+}
+
+// setConfig sets the build configuration of the packages scanned next,
+// the call sites are visited anew for every configuration, they may
+// resolve to other constants
+func (f *queryFinder) setConfig(config string) {
+	if config != f.config {
+		f.config, f.seen = config, map[token.Position]struct{}{}
+	}
+}
+
+// unresolved returns the matched calls which queries can't be extracted
+func (f *queryFinder) unresolved() []callSite {
+	var sites []callSite
+	for _, site := range f.sites {
+		if !site.Status.resolved() {
+			sites = append(sites, site)
+		}
+	}
+	return sites
+}
+
+// markExcluded marks the call sites the statement excluded by
+// -exclude-query is extracted at as excluded by the pattern
+func (f *queryFinder) markExcluded(e excludedQuery) {
+	positions := make(map[token.Position]struct{}, len(e.Pos))
+	for _, pos := range e.Pos {
+		positions[pos] = struct{}{}
+	}
+
+	for i, site := range f.sites {
+		if _, ok := positions[site.Pos]; ok && site.Status == siteExtracted {
+			f.sites[i].Status = siteExcluded
+			f.sites[i].Reason = "matches -exclude-query " + e.pattern
+		}
+	}
+}
+
+// resolved reports whether the query of the call site is known, the
+// excluded and ignored ones including
+func (s siteStatus) resolved() bool {
+	return s == siteExtracted || s == siteIgnored || s == siteExcluded
+}
+
+// logf logs the message prefixed with the position of the node
+// if the verbose mode is enabled
+func (f *queryFinder) logf(node ast.Node, format string, args ...interface{}) {
+	if !f.verbose {
+		return
+	}
+
+	pos := f.fs.Position(node.Pos())
+	log.Printf("prep: %s:%d: "+format, append([]interface{}{pos.Filename, pos.Line}, args...)...)
+}
+
+// warnf logs the warning prefixed with the position of the node
+func (f *queryFinder) warnf(node ast.Node, format string, args ...interface{}) {
+	pos := f.fs.Position(node.Pos())
+	log.Printf("prep: %s:%d: warning: "+format, append([]interface{}{pos.Filename, pos.Line}, args...)...)
+}
+
+// isIdent reports whether the expression is an identifier
+func isIdent(expr ast.Expr) bool {
+	_, ok := expr.(*ast.Ident)
+	return ok
+}
+
+// isSelector reports whether the expression is a selector expression
+func isSelector(expr ast.Expr) bool {
+	_, ok := expr.(*ast.SelectorExpr)
+	return ok
+}
+
+// changesOf returns the comma separated positions the variable the
+// identifier refers to is changed at, an empty string if there are none
+func (f *queryFinder) changesOf(expr ast.Expr) string {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return ""
+	}
+
+	var positions []string
+	for _, pos := range f.varChanges[f.info.Uses[ident]] {
+		p := f.fs.Position(pos)
+		positions = append(positions, fmt.Sprintf("%s:%d", filepath.Base(p.Filename), p.Line))
+	}
+	return strings.Join(positions, ", ")
+}
+
+// isConcatenation reports whether the expression is a binary or a
+// parenthesized expression
+func isConcatenation(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.BinaryExpr, *ast.ParenExpr:
+		return true
+	}
+	return false
+}
+
+// isVar reports whether the identifier or the selector expression
+// refers to a variable
+func (f *queryFinder) isVar(expr ast.Expr) bool {
+	if selector, ok := expr.(*ast.SelectorExpr); ok {
+		expr = selector.Sel
+	}
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return false
+	}
+	_, ok = f.info.Uses[ident].(*types.Var)
+	return ok
+}
+
+// processQuery returns a string value of the expression and the name
+// of the constant if the expression is either a string literal or
+// a string constant, including the constants of the imported packages,
+// otherwise an empty string is returned
+func (f *queryFinder) processQuery(queryArg ast.Expr) (value, name string) {
+	switch q := queryArg.(type) {
+	case *ast.BasicLit:
+		return q.Value, ""
+	case *ast.Ident:
+		// the identifier refers to the innermost declaration
+		switch obj := f.info.Uses[q].(type) {
+		case *types.Var:
+			return f.constVars[obj], ""
+		case *types.Const:
+			return f.constValue(obj)
+		}
+	case *ast.SelectorExpr:
+		if c, ok := f.info.Uses[q.Sel].(*types.Const); ok {
+			return f.constValue(c)
+		}
+	case *ast.CallExpr:
+		// the conversion of a constant to a string type keeps its name
+		if tv, ok := f.info.Types[q.Fun]; ok && tv.IsType() && len(q.Args) == 1 {
+			if value, name = f.processQuery(q.Args[0]); value != "" {
+				return value, name
+			}
+		}
+		if tv, ok := f.info.Types[queryArg]; ok && tv.Value != nil && tv.Value.Kind() == constant.String {
+			return tv.Value.ExactString(), ""
+		}
+	case *ast.BinaryExpr, *ast.ParenExpr:
+		// the concatenation of the constants and the literals is
+		// folded by the type checker
+		if tv, ok := f.info.Types[queryArg]; ok && tv.Value != nil && tv.Value.Kind() == constant.String {
+			return tv.Value.ExactString(), ""
+		}
+	}
+	return "", ""
+}
+
+// constValue returns the value and the name of the constant, an empty
+// string if the underlying type of the constant is not a string or if
+// it is declared by a file of the package that is not scanned
+func (f *queryFinder) constValue(c *types.Const) (value, name string) {
+	if c.Val().Kind() != constant.String {
+		return "", ""
+	}
+	if c.Pkg() == f.pkg {
+		if _, ok := f.skipped[f.fs.Position(c.Pos()).Filename]; ok {
+			return "", ""
+		}
+	}
+	return c.Val().ExactString(), f.constName(c)
+}
+
+// constName returns the name of the package level constant, empty for
+// the variables and the local constants which names don't identify the
+// statement, the names declared by an external test package are
+// qualified by the package name, the names may be declared by the
+// package under test too
+func (f *queryFinder) constName(obj types.Object) string {
+	if _, ok := obj.(*types.Const); !ok || obj.Pkg() == nil || obj.Parent() != obj.Pkg().Scope() {
+		return ""
+	}
+	if obj.Pkg() == f.pkg && strings.HasSuffix(f.pkg.Name(), "_test") {
+		return f.pkg.Name() + "." + obj.Name()
+	}
+	return obj.Name()
+}
+
+// declFile returns the base name of the file declaring the object,
+// empty for nil
+func (f *queryFinder) declFile(obj types.Object) string {
+	if obj == nil {
+		return ""
+	}
+	return filepath.Base(f.fs.Position(obj.Pos()).Filename)
+}
+
+// constOf returns the constant the query argument, possibly converted,
+// refers to, nil if it refers to none
+func (f *queryFinder) constOf(queryArg ast.Expr) types.Object {
+	switch q := queryArg.(type) {
+	case *ast.Ident:
+		if c, ok := f.info.Uses[q].(*types.Const); ok {
+			return c
+		}
+	case *ast.SelectorExpr:
+		return f.constOf(q.Sel)
+	case *ast.CallExpr:
+		if len(q.Args) == 1 {
+			return f.constOf(q.Args[0])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFixtures(t *testing.T) {
+	tests := []struct {
+		fixture string
+		args    []string
+		files   []string
+	}{
+		// every method and function of sqlx, of the handles and of the
+		// transactions
+		{fixture: "sqlx", args: []string{"-f", "."}, files: []string{"prepared_statements.go"}},
+		// the pgx handles take the context first, the database/sql
+		// methods of the same names don't
+		{fixture: "pgx", args: []string{"-f", "."}, files: []string{"prepared_statements.go"}},
+		// the pinned connections and the transactions of database/sql
+		// and sqlx, the other types of the same methods aren't handles
+		{fixture: "receivers", args: []string{"-f", "."}, files: []string{"prepared_statements.go"}},
+		// the methods promoted from the embedded handles and interfaces
+		// and the field chains leading to a handle
+		{fixture: "embedding", args: []string{"-f", "."}, files: []string{"prepared_statements.go"}},
+		// the two and three link chains of Unsafe, MustBegin and the
+		// rebound statements
+		{fixture: "chains", args: []string{"-f", "."}, files: []string{"prepared_statements.go"}},
+		// the queries forwarded to the explicitly and implicitly
+		// instantiated helpers and the methods of the generic types
+		{fixture: "generics", args: []string{"-f", "."}, files: []string{"prepared_statements.go"}},
+		// the multi-name specs, the blank identifiers, the blocks split
+		// across files and the names shared with the external tests
+		{fixture: "consts", args: []string{"-f", ".", "-include-tests"}, files: []string{"prepared_statements.go"}},
+		// the named statements prepared and executed in other functions,
+		// prepared as named statements by prepareAllx
+		{fixture: "named", args: []string{"-f", ".", "-sqlx"}, files: []string{"prepared_statements.go"}},
+		// the init functions, the package level initializers and the
+		// field values of the composite literals
+		{fixture: "bootstrap", args: []string{"-f", "."}, files: []string{"prepared_statements.go"}},
+		// only the package level constants name the statements, the
+		// variables and the local constants are keyed by their hashes
+		{fixture: "names", args: []string{"-f", ".", "-prepare-all", "-struct"}, files: []string{"prepared_statements.go"}},
+		// the wrappers forwarding several parameters and forwarding the
+		// parameter to several calls
+		{fixture: "wrappers", args: []string{"-f", "."}, files: []string{"prepared_statements.go"}},
+		// the keys of the literals colliding with each other and with a
+		// constant and the constants of the build configurations sharing
+		// the name
+		{fixture: "keys", args: []string{"-f", ".", "-format", "map", "-all-build-configs"}, files: []string{"prepared_statements.go"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fixture, func(t *testing.T) {
+			dir := fixture(t, test.fixture)
+			if result := runFixture(t, test.args...); result.exitCode != exitOK {
+				t.Fatalf("exit code %d", result.exitCode)
+			}
+			checkGolden(t, dir, test.files...)
+		})
+	}
+}
+
+func TestConcatenation(t *testing.T) {
+	dir := fixture(t, "concat")
+	logs := &bytes.Buffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	if result := runFixture(t, "-f", "."); result.exitCode != exitOK {
+		t.Fatalf("exit code %d", result.exitCode)
+	}
+	checkGolden(t, dir, "prepared_statements.go")
+
+	// the warnings are logged without -v
+	want := `store.go:20: warning: QueryContext: unresolved, selectBase + " WHERE " + filter is not a constant expression`
+	if !strings.Contains(logs.String(), want) {
+		t.Errorf("the log misses %s:\n%s", want, logs)
+	}
+}
@@ -0,0 +1,1173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go/build/constraint"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/wayfarer-games/prep/tmpl"
+)
+
+// directive returns the go:generate directive that reproduces
+// the current run of the tool
+func directive(importPath string, opts *options) string {
+	args := []string{"prep", "-f", importPath}
+	if opts.outputFileName != "" {
+		args = append(args, "-o", opts.outputFileName)
+	}
+	if opts.fileName != "" {
+		args = append(args, "-filename", opts.fileName)
+	}
+	if opts.dir != "" {
+		// go generate runs the directive in the directory of the
+		// generated file
+		args = append(args, "-dir", ".")
+	}
+	if opts.pkg != "" {
+		args = append(args, "-pkg", opts.pkg)
+	}
+	if opts.varName != defaultVarName {
+		args = append(args, "-var", opts.varName)
+	}
+	if opts.format != formatSlice {
+		args = append(args, "-format", opts.format)
+	}
+	// the defaults set explicitly override the configuration file
+	if opts.extractSprintf {
+		args = append(args, "-extract-sprintf")
+	}
+	if opts.prepareAll {
+		args = append(args, "-prepare-all")
+	}
+	if opts.sqlx {
+		args = append(args, "-sqlx")
+	}
+	if opts.statementsStruct {
+		args = append(args, "-struct")
+	}
+	switch {
+	case opts.setFlags["export"] && opts.export:
+		args = append(args, "-export")
+	case opts.setFlags["export"]:
+		args = append(args, "-export=false")
+	}
+	if opts.inventory {
+		args = append(args, "-inventory")
+	}
+	if opts.alsoSQL {
+		args = append(args, "-also-sql")
+	}
+	if opts.statementIDs {
+		args = append(args, "-statement-names")
+	}
+	if opts.pgx {
+		args = append(args, "-pgx")
+	}
+	if opts.rawStrings {
+		args = append(args, "-raw-strings")
+	}
+	if opts.splitByFile {
+		args = append(args, "-split-by-file")
+	}
+	if opts.appendInit {
+		args = append(args, "-append-init")
+	}
+	if opts.templateFile != "" {
+		args = append(args, "-template", opts.templateFile)
+	}
+	if opts.normalize {
+		args = append(args, "-normalize")
+	} else if opts.setFlags["normalize"] {
+		args = append(args, "-normalize=false")
+	}
+	if opts.dialect != dialectNone || opts.setFlags["dialect"] {
+		args = append(args, "-dialect", opts.dialect)
+	}
+	if opts.sort != sortAlpha {
+		args = append(args, "-sort", opts.sort)
+	}
+	if opts.tags != "" {
+		args = append(args, "-tags", opts.tags)
+	}
+	if opts.mod != "" {
+		args = append(args, "-mod", opts.mod)
+	}
+	if opts.modFile != "" {
+		args = append(args, "-modfile", opts.modFile)
+	}
+	if opts.goos != "" {
+		args = append(args, "-goos", opts.goos)
+	}
+	if opts.goarch != "" {
+		args = append(args, "-goarch", opts.goarch)
+	}
+	if opts.allPlatforms {
+		args = append(args, "-all-platforms")
+	}
+	if opts.allBuildConfigs {
+		args = append(args, "-all-build-configs")
+	}
+	if opts.includeTests {
+		args = append(args, "-include-tests")
+	}
+	if opts.testOutput {
+		args = append(args, "-test-output")
+	}
+	if opts.dynamicLookups {
+		args = append(args, "-dynamic-lookups")
+	}
+	if opts.includeGenerated {
+		args = append(args, "-include-generated")
+	}
+	if opts.headerFile != "" {
+		args = append(args, "-header", opts.headerFile)
+	}
+	if opts.validate {
+		args = append(args, "-validate")
+	}
+	if len(opts.deny) > 0 {
+		args = append(args, "-deny", strings.Join(opts.deny, ","))
+	}
+	for _, pattern := range opts.excludeQueries {
+		args = append(args, "-exclude-query", pattern)
+	}
+	if opts.appendManual {
+		args = append(args, "-append")
+	}
+	if opts.buildTag != "" {
+		args = append(args, "-build-tag", opts.buildTag)
+	}
+	if opts.legacyBuildTags {
+		args = append(args, "-legacy-build-tags")
+	}
+	if opts.allowEmpty {
+		args = append(args, "-allow-empty")
+	}
+	if opts.strict {
+		args = append(args, "-strict")
+	}
+	if opts.configFile != "" {
+		args = append(args, "-config", opts.configFile)
+	}
+	for _, pattern := range opts.exclude {
+		args = append(args, "-exclude", pattern)
+	}
+	for _, dir := range opts.sqlDirs {
+		args = append(args, "-sqldir", dir)
+	}
+	for _, method := range opts.methods.args() {
+		args = append(args, "-method", method)
+	}
+	for _, receiver := range opts.receivers {
+		args = append(args, "-receiver", receiver)
+	}
+
+	for i, arg := range args {
+		args[i] = quoteArg(arg)
+	}
+
+	return "//go:generate " + strings.Join(args, " ")
+}
+
+// quoteArg quotes the argument of the go:generate directive if
+// it would otherwise be split or unquoted by the go command
+func quoteArg(arg string) string {
+	if arg == "" || strings.ContainsAny(arg, " \t\"\\") {
+		return strconv.Quote(arg)
+	}
+	return arg
+}
+
+// generatedComment is the standard comment marking the file generated by
+// the tool, the linters and the code review tools skip the files carrying it
+var generatedComment = regexp.MustCompile(`^// Code generated by prep .*\. DO NOT EDIT\.$`)
+
+// header returns the header of the generated file, the standard Code
+// generated comment recording the version of the tool comes first, the
+// build lines and the custom comment block, if any, follow it and the
+// directive reproducing the file ends it
+func header(comment, build, directive string) string {
+	h := fmt.Sprintf("// Code generated by prep %s. DO NOT EDIT.", version())
+	if build == "" && comment == "" {
+		return h + "\n" + directive
+	}
+
+	for _, part := range []string{build, comment} {
+		if part != "" {
+			h += "\n\n" + part
+		}
+	}
+	return h + "\n\n" + directive
+}
+
+// buildLines returns the //go:build line of the constraint expression
+// followed by its // +build lines if legacy is set
+func buildLines(expr string, legacy bool) (string, error) {
+	x, err := constraint.Parse("//go:build " + expr)
+	if err != nil {
+		return "", fmt.Errorf("invalid -build-tag %q: %v", expr, err)
+	}
+
+	lines := []string{"//go:build " + x.String()}
+	if legacy {
+		plus, err := constraint.PlusBuildLines(x)
+		if err != nil {
+			return "", fmt.Errorf("-build-tag %q has no // +build form: %v", expr, err)
+		}
+		lines = append(lines, plus...)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// commentBlock turns the text into a block of line comments, the lines
+// that already are comments are kept as is
+func commentBlock(text string) string {
+	text = strings.TrimRight(text, " \t\r\n")
+	if text == "" {
+		return ""
+	}
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		switch {
+		case strings.HasPrefix(strings.TrimSpace(line), "//"):
+		case line == "":
+			line = "//"
+		default:
+			line = "// " + line
+		}
+		lines[i] = line
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// output formats
+const (
+	formatSlice = "slice"
+	formatMap   = "map"
+	formatJSON  = "json"
+	formatSQL   = "sql"
+	formatYAML  = "yaml"
+	formatMD    = "md"
+)
+
+// orders of the emitted statements
+const (
+	sortAlpha  = "alpha"
+	sortSource = "source"
+)
+
+type (
+	// query is a statement discovered in the source package
+	query struct {
+		// Value is the Go literal of the statement
+		Value string
+		// Name is the name of the constant holding the statement,
+		// empty for the string literals
+		Name string
+		// File is the base name of the file declaring the constant of
+		// Name, the constants of distinct build configurations may
+		// share the name
+		File string
+		// Key is the key of the string literal set by uniqueKeys
+		Key string
+		// Pos holds the positions of the calls the statement is
+		// found at
+		Pos []token.Position
+		// NoValidate excludes the statement from -validate
+		NoValidate bool
+	}
+
+	// target describes the generated file
+	target struct {
+		// packageName is the name of the package the file belongs to
+		packageName string
+		// sourcePackageName is the name of the scanned package
+		sourcePackageName string
+		// importPath is the import path of the scanned package
+		importPath string
+		varName    string
+		// declare makes the generated code to declare the variable
+		// instead of assigning it in init, the scanned package can
+		// then import it
+		declare bool
+		header  string
+		// export exports the generated functions and types
+		export bool
+		// dialect is the SQL dialect of the statements
+		dialect string
+		// outputDir is the directory of the generated file, the
+		// positions of the inventories and of the comments of the
+		// statements are relative to it
+		outputDir string
+		// manual holds the manually curated statements emitted after
+		// the discovered ones
+		manual manualSection
+		// templates holds the format strings of the queries formatted
+		// by fmt.Sprintf, nil unless they are generated
+		templates []string
+		// prepareAll makes the function preparing the statements to
+		// be generated too
+		prepareAll bool
+		// prepareAllx makes the function preparing the statements
+		// against a *sqlx.DB to be generated too
+		prepareAllx bool
+		// statementsStruct makes the struct with a field per constant
+		// holding a statement and the function preparing them to be
+		// generated too
+		statementsStruct bool
+		// appendStatements makes the generated code to append the
+		// statements to the variable in init instead of assigning it,
+		// the files written by -split-by-file and -append-init share
+		// the variable
+		appendStatements bool
+		// checksum is the checksum of the statements of the variable
+		checksum string
+		// statementIDs holds the stable identifiers of the statements
+		// sorted by the identifier, nil unless they are generated
+		statementIDs []statementID
+	}
+
+	// statementID is the stable identifier of the statement derived
+	// from its normalized text
+	statementID struct {
+		id string
+		// value is the Go literal of the statement
+		value string
+		// names are the names of the constants holding the statement
+		names []string
+	}
+
+	// excludedQuery is a statement dropped by -exclude-query
+	excludedQuery struct {
+		query
+		// pattern is the first pattern matching the statement
+		pattern string
+	}
+
+	// generator returns the contents of the generated file
+	generator func(t target, queries []query) ([]byte, error)
+)
+
+// generators maps output formats to their generators
+var generators = map[string]generator{
+	formatSlice: generateCode,
+	formatMap:   generateMapCode,
+	formatJSON:  generateJSON,
+	formatSQL:   generateSQL,
+	formatYAML:  generateYAML,
+	formatMD:    generateMarkdown,
+}
+
+// formatFileNames maps output formats to the default names of
+// their output files
+var formatFileNames = map[string]string{
+	formatSlice: defaultOutputFileName,
+	formatMap:   defaultOutputFileName,
+	formatJSON:  "queries.json",
+	formatSQL:   "prepared_statements.sql",
+	formatYAML:  "prepared_statements.yaml",
+	formatMD:    "QUERIES.md",
+}
+
+// maxCommentPositions is the most positions of a statement listed by
+// the comment preceding it in the generated code
+const maxCommentPositions = 3
+
+// templatesVarName is the name of the variable the format strings of
+// -extract-sprintf are declared by
+const templatesVarName = "formatTemplates"
+
+// isGoFormat reports whether the format produces Go source
+func isGoFormat(format string) bool {
+	return format == formatSlice || format == formatMap
+}
+
+// generateCode generates the code assigning the statements to a
+// slice in the order they are sorted in
+func generateCode(t target, queries []query) ([]byte, error) {
+	return goCode(newTemplateData(t, queries, false))
+}
+
+// generateMapCode generates the code assigning the statements to
+// a map keyed by the names of the constants holding them
+func generateMapCode(t target, queries []query) ([]byte, error) {
+	return goCode(newTemplateData(t, queries, true))
+}
+
+// sourceComment returns the comment listing the first positions the
+// query is found at and the name of the constant holding it, empty if
+// there are neither
+func sourceComment(t target, q query) string {
+	positions := append([]token.Position{}, q.Pos...)
+	sort.Slice(positions, func(i, j int) bool { return positionLess(positions[i], positions[j]) })
+
+	var locations []string
+	for i, pos := range positions {
+		if i == maxCommentPositions {
+			locations = append(locations, fmt.Sprintf("and %d more", len(positions)-i))
+			break
+		}
+		locations = append(locations, fmt.Sprintf("%s:%d", t.relativePath(pos.Filename), pos.Line))
+	}
+
+	comment := strings.Join(locations, ", ")
+	if q.Name != "" {
+		comment = strings.TrimSpace(comment + " (" + q.Name + ")")
+	}
+	return comment
+}
+
+// relativePath returns the slash separated path of the file relative
+// to the output directory, the path as is if it can't be made relative
+func (t target) relativePath(file string) string {
+	if rel, err := filepath.Rel(t.outputDir, file); err == nil && t.outputDir != "" {
+		return filepath.ToSlash(rel)
+	}
+	return file
+}
+
+// statementsChecksum returns the checksum of the set of the statements,
+// the SHA-256 of their sorted unquoted normalized texts, the quoting and
+// the order of the statements don't change it
+func statementsChecksum(queries []query) string {
+	texts := make([]string, 0, len(queries))
+	seen := map[string]struct{}{}
+	for _, q := range queries {
+		if q.Value == "" {
+			continue
+		}
+		text := normalize(unquote(q.Value))
+		if _, ok := seen[text]; !ok {
+			seen[text] = struct{}{}
+			texts = append(texts, text)
+		}
+	}
+	sort.Strings(texts)
+
+	h := sha256.New()
+	for _, text := range texts {
+		h.Write([]byte(text))
+		h.Write([]byte{0})
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// statementIDPrefix precedes the hash of the identifiers of the
+// statements, the identifiers are valid names of the prepared
+// statements of the servers
+const statementIDPrefix = "q_"
+
+// newStatementIDs returns the stable identifiers of the statements, the
+// first 12 hex digits of the SHA-256 of their unquoted normalized text,
+// sorted by the identifier, the error reports the distinct statements
+// sharing one
+func newStatementIDs(queries []query) ([]statementID, error) {
+	byID := map[string]*statementID{}
+	texts := map[string]string{}
+	for _, q := range queries {
+		if q.Value == "" {
+			continue
+		}
+
+		text := normalize(unquote(q.Value))
+		sum := sha256.Sum256([]byte(text))
+		id := statementIDPrefix + hex.EncodeToString(sum[:6])
+
+		existing, ok := byID[id]
+		switch {
+		case !ok:
+			existing = &statementID{id: id, value: q.Value}
+			byID[id], texts[id] = existing, text
+		case texts[id] != text:
+			return nil, fmt.Errorf("statements %s and %s share the identifier %s", existing.value, q.Value, id)
+		case q.Value < existing.value:
+			existing.value = q.Value
+		}
+		if q.Name != "" {
+			existing.names = append(existing.names, q.Name)
+		}
+	}
+
+	ids := make([]statementID, 0, len(byID))
+	for _, id := range byID {
+		sort.Strings(id.names)
+		ids = append(ids, *id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].id < ids[j].id })
+	return ids, nil
+}
+
+// statementIDsVarName returns the name of the variable mapping the
+// identifiers of the statements to them, i.e. prepStatementNames
+func statementIDsVarName(varName string) string {
+	return strings.TrimSuffix(varName, "s") + "Names"
+}
+
+// statementIDsCode returns the variable mapping the identifiers of the
+// statements to them followed by the constants of the identifiers of
+// the statements held by constants
+func statementIDsCode(t target) string {
+	name := statementIDsVarName(t.varName)
+	buf := bytes.NewBuffer([]byte{})
+
+	fmt.Fprintf(buf, "\n\n// %s maps the stable names of the statements of %s to them.\n", name, t.varName)
+	fmt.Fprintf(buf, "var %s = map[string]string{", name)
+	if len(t.statementIDs) > 0 {
+		buf.WriteString("\n")
+		for _, id := range t.statementIDs {
+			fmt.Fprintf(buf, "\t%q: %s,\n", id.id, id.value)
+		}
+	}
+	buf.WriteString("}")
+
+	var consts []statementField
+	for _, id := range t.statementIDs {
+		for _, name := range id.names {
+			consts = append(consts, statementField{name: t.generatedName("stmt") + fieldName(name), key: name, query: strconv.Quote(id.id)})
+		}
+	}
+	if len(consts) == 0 {
+		return buf.String()
+	}
+
+	consts = uniqueFields(consts)
+	width := 0
+	for _, c := range consts {
+		if len(c.name) > width {
+			width = len(c.name)
+		}
+	}
+	buf.WriteString("\n\n// names of the statements of the constants\nconst (\n")
+	for _, c := range consts {
+		fmt.Fprintf(buf, "\t%-*s = %s\n", width, c.name, c.query)
+	}
+	buf.WriteString(")")
+	return buf.String()
+}
+
+// goCode returns the Go file assigning the statements of the data to the
+// variable, or declaring the variable with them, executing the default
+// template
+func goCode(data tmpl.Data) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+	if err := defaultTemplate.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute default template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// generateJSON generates the JSON inventory of the statements
+func generateJSON(t target, queries []query) ([]byte, error) {
+	type entry struct {
+		Name  string `json:"name,omitempty"`
+		Query string `json:"query"`
+	}
+
+	inventory := struct {
+		Package  string  `json:"package"`
+		Checksum string  `json:"checksum"`
+		Queries  []entry `json:"queries"`
+	}{Package: t.sourcePackageName, Checksum: statementsChecksum(queries), Queries: []entry{}}
+
+	for _, q := range queries {
+		inventory.Queries = append(inventory.Queries, entry{Name: q.Name, Query: unquote(q.Value)})
+	}
+
+	code, err := json.MarshalIndent(inventory, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JSON: %v", err)
+	}
+	return append(code, '\n'), nil
+}
+
+// generateInventory generates the JSON inventory written next to the Go
+// code by -inventory, the statements without a value are left out
+func generateInventory(t target, queries []query) []byte {
+	type entry struct {
+		SQL       string         `json:"sql"`
+		Name      string         `json:"name,omitempty"`
+		SHA256    string         `json:"sha256"`
+		Dialect   string         `json:"dialect"`
+		Positions []jsonPosition `json:"positions"`
+	}
+
+	entries := []entry{}
+	for _, q := range queries {
+		if q.Value == "" {
+			continue
+		}
+
+		sql := unquote(q.Value)
+		sum := sha256.Sum256([]byte(sql))
+		e := entry{SQL: sql, Name: q.Name, SHA256: hex.EncodeToString(sum[:]), Dialect: t.dialect, Positions: []jsonPosition{}}
+
+		positions := append([]token.Position{}, q.Pos...)
+		sort.Slice(positions, func(i, j int) bool { return positionLess(positions[i], positions[j]) })
+		for _, pos := range positions {
+			e.Positions = append(e.Positions, jsonPosition{File: t.relativePath(pos.Filename), Line: pos.Line, Column: pos.Column})
+		}
+		entries = append(entries, e)
+	}
+
+	code, _ := json.MarshalIndent(entries, "", "  ")
+	return append(code, '\n')
+}
+
+// splitMarker precedes the name of the source file in the header of the
+// files written by -split-by-file
+const splitMarker = "// Statements of "
+
+// splitPath returns the path of the file written by -split-by-file for
+// the statements of the source file of the base name without extension
+func splitPath(outputPath, base string) string {
+	return strings.TrimSuffix(outputPath, ".go") + "_" + base + ".go"
+}
+
+// fileOS and fileArch are the GOOS and GOARCH known to the go command,
+// the files named with their _GOOS, _GOARCH and _GOOS_GOARCH suffixes
+// are built for them only
+var (
+	fileOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "hurd": true,
+		"illumos": true, "ios": true, "js": true, "linux": true, "nacl": true, "netbsd": true,
+		"openbsd": true, "plan9": true, "solaris": true, "wasip1": true, "windows": true, "zos": true,
+	}
+	fileArch = map[string]bool{
+		"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true, "arm64": true,
+		"arm64be": true, "loong64": true, "mips": true, "mipsle": true, "mips64": true, "mips64le": true,
+		"mips64p32": true, "mips64p32le": true, "ppc": true, "ppc64": true, "ppc64le": true, "riscv": true,
+		"riscv64": true, "s390": true, "s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+	}
+)
+
+// splitBase returns the base name of the source file without the
+// extension, the _GOOS and _GOARCH suffixes are stripped since the file
+// written by -split-by-file would be built for the platform only, empty
+// if the name holds nothing else
+func splitBase(filename string) string {
+	name := filepath.Base(filename)
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	base, test := strings.CutSuffix(base, "_test")
+
+	elems := strings.Split(base, "_")
+	if n := len(elems); n >= 2 && fileOS[elems[n-2]] && fileArch[elems[n-1]] {
+		elems = elems[:n-2]
+	} else if fileOS[elems[n-1]] || fileArch[elems[n-1]] {
+		elems = elems[:n-1]
+	}
+
+	base = strings.Join(elems, "_")
+	if test && base != "" {
+		base += "_test"
+	}
+	return base
+}
+
+// splitQueries returns the queries grouped by the split base name of the
+// file they are first found at, the files of the tests only if the query
+// is found at no other, the queries found at no position and the ones
+// of the files named by the platforms only are grouped under the empty
+// name
+func splitQueries(queries []query) map[string][]query {
+	groups := map[string][]query{}
+	for _, q := range queries {
+		var positions []token.Position
+		for _, pos := range q.Pos {
+			if !strings.HasSuffix(pos.Filename, "_test.go") {
+				positions = append(positions, pos)
+			}
+		}
+		if len(positions) == 0 {
+			positions = q.Pos
+		}
+
+		base := ""
+		if first := earliest(positions); first.IsValid() {
+			base = splitBase(first.Filename)
+		}
+		groups[base] = append(groups[base], q)
+	}
+	return groups
+}
+
+// splitFiles returns the files previously written by -split-by-file next
+// to the output path
+func splitFiles(outputPath string) []string {
+	matches, _ := filepath.Glob(splitPath(outputPath, "*"))
+
+	var files []string
+	for _, path := range matches {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		first, _, _ := strings.Cut(string(code), "\n")
+		if generatedComment.MatchString(first) && strings.Contains(string(code), "\n"+splitMarker) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// companionPath returns the path of the file with the extension written
+// next to the Go code of the output path
+func companionPath(outputPath, ext string) string {
+	return strings.TrimSuffix(outputPath, ".go") + ext
+}
+
+// generateMarkdown generates the Markdown documentation of the statements
+// in the source order with the table of contents, the section of every
+// statement gives its constant, positions and number of parameters
+func generateMarkdown(t target, queries []query) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(buf, "<!-- Generated by prep. DO NOT EDIT. -->\n\n# Queries of the %s package\n\n", t.sourcePackageName)
+	if len(queries) == 0 {
+		buf.WriteString("The package has no queries.\n")
+		return buf.Bytes(), nil
+	}
+
+	queries = sortQueries(queries, sortSource)
+	anchors := map[string]int{}
+	ids := make([]string, 0, len(queries))
+	for _, q := range queries {
+		ids = append(ids, markdownAnchor(queryKey(q), anchors))
+	}
+
+	for i, q := range queries {
+		fmt.Fprintf(buf, "- [%s](#%s)\n", queryKey(q), ids[i])
+	}
+
+	for _, q := range queries {
+		sql := strings.TrimSpace(strings.ReplaceAll(unquote(q.Value), "\r\n", "\n"))
+		fence := "```"
+		for strings.Contains(sql, fence) {
+			fence += "`"
+		}
+
+		fmt.Fprintf(buf, "\n## %s\n\n", queryKey(q))
+		if q.Name != "" {
+			fmt.Fprintf(buf, "Constant: `%s`\n\n", q.Name)
+		} else {
+			buf.WriteString("String literal\n\n")
+		}
+		fmt.Fprintf(buf, "Parameters: %d\n\n", placeholderCount(sql))
+		fmt.Fprintf(buf, "%ssql\n%s\n%s\n", fence, sql, fence)
+
+		if len(q.Pos) == 0 {
+			continue
+		}
+
+		positions := append([]token.Position{}, q.Pos...)
+		sort.Slice(positions, func(i, j int) bool { return positionLess(positions[i], positions[j]) })
+		buf.WriteString("\nUsed at:\n\n")
+		for _, pos := range positions {
+			fmt.Fprintf(buf, "- `%s:%d`\n", t.relativePath(pos.Filename), pos.Line)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// markdownAnchor returns the anchor of the heading with the text the
+// way GitHub derives it, the anchors already taken are suffixed by
+// their number
+func markdownAnchor(text string, taken map[string]int) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		}
+	}
+
+	anchor := b.String()
+	n := taken[anchor]
+	taken[anchor]++
+	if n > 0 {
+		anchor = fmt.Sprintf("%s-%d", anchor, n)
+	}
+	return anchor
+}
+
+// generateSQL generates the SQL file with the statements terminated by
+// semicolons and separated by blank lines, the comment preceding every
+// statement gives its positions and the name of its constant
+func generateSQL(t target, queries []query) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+
+	for i, q := range queries {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		if comment := sourceComment(t, q); comment != "" {
+			fmt.Fprintf(buf, "-- %s\n", comment)
+		}
+		fmt.Fprintf(buf, "%s\n", terminated(strings.TrimSpace(strings.ReplaceAll(unquote(q.Value), "\r\n", "\n"))))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// terminated returns the statement terminated by a semicolon unless it
+// already is, the semicolon following a trailing line comment is put
+// on its own line
+func terminated(sql string) string {
+	segments, _ := splitSQL(sql)
+	if len(segments) == 0 {
+		return ";"
+	}
+
+	last := segments[len(segments)-1]
+	switch {
+	case last.kind == segmentLineComment:
+		return sql + "\n;"
+	case last.kind == segmentCode && strings.HasSuffix(strings.TrimSpace(last.text), ";"):
+		return sql
+	}
+	return sql + ";"
+}
+
+// generateYAML generates the YAML inventory of the statements, the
+// multi-line statements are block scalars
+func generateYAML(t target, queries []query) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+
+	fmt.Fprintf(buf, "package: %s\n", yamlString(t.sourcePackageName))
+	if len(queries) == 0 {
+		buf.WriteString("queries: []\n")
+		return buf.Bytes(), nil
+	}
+
+	buf.WriteString("queries:\n")
+	for _, q := range queries {
+		fmt.Fprintf(buf, "  - id: %s\n", yamlString(queryKey(q)))
+		fmt.Fprintf(buf, "    dialect: %s\n", yamlString(t.dialect))
+		fmt.Fprintf(buf, "    sql: %s\n", yamlText(unquote(q.Value), 6))
+		if len(q.Pos) == 0 {
+			buf.WriteString("    locations: []\n")
+			continue
+		}
+
+		buf.WriteString("    locations:\n")
+		for _, pos := range q.Pos {
+			fmt.Fprintf(buf, "      - file: %s\n        line: %d\n        column: %d\n", yamlString(t.relativePath(pos.Filename)), pos.Line, pos.Column)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// plainScalar matches the strings that can be written as plain YAML
+// scalars
+var plainScalar = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./-]*$`)
+
+// yamlKeywords are the plain scalars that aren't read as strings
+var yamlKeywords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"null": true, "y": true, "n": true, "~": true,
+}
+
+// yamlString returns the YAML scalar of the string, plain if it can't
+// be read as anything else, double quoted otherwise
+func yamlString(s string) string {
+	if plainScalar.MatchString(s) && !yamlKeywords[strings.ToLower(s)] {
+		return s
+	}
+
+	// the JSON strings are YAML double quoted scalars
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// yamlText returns the YAML scalar of the text, the multi-line texts
+// are literal block scalars which lines are indented by the indent
+func yamlText(text string, indent int) string {
+	if !strings.Contains(text, "\n") || strings.ContainsAny(text, "\r\x00") || strings.TrimSpace(text) == "" {
+		return yamlString(text)
+	}
+
+	// the chomping indicator keeps the trailing line breaks as is
+	body := strings.TrimRight(text, "\n")
+	breaks := len(text) - len(body)
+	chomp := ""
+	switch {
+	case breaks == 0:
+		chomp = "-"
+	case breaks > 1:
+		chomp = "+"
+	}
+
+	// the indentation of the block can't be detected from its first
+	// non-empty line if it starts with a space
+	indicator := ""
+	if strings.HasPrefix(strings.TrimLeft(body, "\n"), " ") {
+		indicator = "2"
+	}
+
+	lines := strings.Split(body, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = strings.Repeat(" ", indent) + line
+		}
+	}
+
+	block := "|" + indicator + chomp + "\n" + strings.Join(lines, "\n")
+	if breaks > 1 {
+		block += strings.Repeat("\n", breaks-1)
+	}
+	return block
+}
+
+// literalKeyPrefix prefixes the keys of the string literals
+const literalKeyPrefix = "lit_"
+
+// queryKey returns the name of the constant holding the query or
+// a key derived from the query for the string literals
+func queryKey(q query) string {
+	switch {
+	case q.Name != "":
+		return q.Name
+	case q.Key != "":
+		return q.Key
+	}
+	return literalKey(q.Value, 3)
+}
+
+// literalKey returns the key of the string literal made of the first n
+// bytes of the hash of its value
+func literalKey(literal string, n int) string {
+	sum := sha256.Sum256([]byte(unquote(literal)))
+	return literalKeyPrefix + hex.EncodeToString(sum[:min(n, len(sum))])
+}
+
+// uniqueKeys returns the queries with the keys of the string literals
+// colliding with each other or with the names of the constants
+// lengthened by a byte of the hash until they don't, the keys depend on
+// the set of the statements only
+func uniqueKeys(queries []query) []query {
+	taken := map[string]bool{}
+	var pending []int
+	for i, q := range queries {
+		if q.Name != "" {
+			taken[q.Name] = true
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for n := 3; len(pending) > 0; n++ {
+		count := map[string]int{}
+		for _, i := range pending {
+			count[literalKey(queries[i].Value, n)]++
+		}
+
+		var colliding []int
+		for _, i := range pending {
+			key := literalKey(queries[i].Value, n)
+			// the whole hash is kept by the statements normalized to
+			// the same text
+			if (count[key] > 1 || taken[key]) && n < sha256.Size {
+				colliding = append(colliding, i)
+				continue
+			}
+			queries[i].Key = key
+		}
+		for _, i := range pending {
+			taken[queries[i].Key] = true
+		}
+		pending = colliding
+	}
+	return queries
+}
+
+// unquote returns the string value of the Go literal
+func unquote(literal string) string {
+	if value, err := strconv.Unquote(literal); err == nil {
+		return value
+	}
+	return literal
+}
+
+// uniqueQueries returns the queries with the unique unquoted values
+// sorted by the value, the spellings of the literals don't matter, the
+// alphabetically first constant name and literal are kept for the
+// duplicates
+func uniqueQueries(queries []query) []query {
+	m := make(map[string]query)
+	for _, q := range queries {
+		text := unquote(q.Value)
+		existing, ok := m[text]
+		pos := append(append([]token.Position{}, existing.Pos...), q.Pos...)
+		noValidate := existing.NoValidate || q.NoValidate
+		literal := q.Value
+		if ok && existing.Value < literal {
+			literal = existing.Value
+		}
+		if !ok || (q.Name != "" && (existing.Name == "" || q.Name < existing.Name)) {
+			existing = q
+		}
+		existing.Value, existing.Pos, existing.NoValidate = literal, uniquePositions(pos), noValidate
+		m[text] = existing
+	}
+
+	unique := make([]query, 0, len(m))
+	for _, q := range m {
+		unique = append(unique, q)
+	}
+
+	sort.Slice(unique, func(i, j int) bool { return unquote(unique[i].Value) < unquote(unique[j].Value) })
+	return unique
+}
+
+// excludeQueries returns the queries but the ones which unquoted and
+// normalized text matches any of the patterns and the excluded ones
+func excludeQueries(queries []query, patterns []*regexp.Regexp) ([]query, []excludedQuery) {
+	if len(patterns) == 0 {
+		return queries, nil
+	}
+
+	kept := make([]query, 0, len(queries))
+	var excluded []excludedQuery
+	for _, q := range queries {
+		text := normalize(unquote(q.Value))
+		matched := ""
+		for _, re := range patterns {
+			if re.MatchString(text) {
+				matched = re.String()
+				break
+			}
+		}
+
+		if matched == "" {
+			kept = append(kept, q)
+			continue
+		}
+		excluded = append(excluded, excludedQuery{query: q, pattern: matched})
+	}
+	return kept, excluded
+}
+
+// uniqueNames returns the queries with the names shared by several of
+// them suffixed by the base name of the file declaring the constant,
+// the constants of distinct build configurations may share the name,
+// the names still shared are suffixed by the key derived from their
+// values instead
+func uniqueNames(queries []query) []query {
+	count := map[string]int{}
+	for _, q := range queries {
+		if q.Name != "" {
+			count[q.Name]++
+		}
+	}
+
+	names := make([]string, len(queries))
+	for i, q := range queries {
+		names[i] = q.Name
+		if count[q.Name] > 1 && q.File != "" {
+			queries[i].Name = q.Name + "_" + fileSuffix(q.File)
+		}
+	}
+
+	suffixed := map[string]int{}
+	for _, q := range queries {
+		if q.Name != "" {
+			suffixed[q.Name]++
+		}
+	}
+	for i, q := range queries {
+		if count[names[i]] > 1 && suffixed[q.Name] > 1 {
+			queries[i].Name = names[i] + "_" + strings.TrimPrefix(literalKey(q.Value, 3), literalKeyPrefix)
+		}
+	}
+	return queries
+}
+
+// fileSuffix returns the base name of the Go file without the extension
+// with the characters not allowed in the identifiers replaced by
+// underscores
+func fileSuffix(file string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, strings.TrimSuffix(filepath.Base(file), ".go"))
+}
+
+// uniquePositions returns the positions without the repeated ones, the
+// call sites of the files shared by the build configurations repeat
+func uniquePositions(positions []token.Position) []token.Position {
+	seen := make(map[token.Position]struct{}, len(positions))
+	unique := positions[:0]
+	for _, pos := range positions {
+		if _, ok := seen[pos]; !ok {
+			seen[pos] = struct{}{}
+			unique = append(unique, pos)
+		}
+	}
+	return unique
+}
+
+// sortQueries returns the queries in the order, the source order sorts
+// them by the file, line and column of their first occurrence, the
+// queries found at the same position or at none are sorted by the
+// unquoted value
+func sortQueries(queries []query, order string) []query {
+	if order != sortSource {
+		return queries
+	}
+
+	sorted := append([]query{}, queries...)
+	sort.Slice(sorted, func(i, j int) bool {
+		pi, pj := earliest(sorted[i].Pos), earliest(sorted[j].Pos)
+		switch {
+		case pi.IsValid() != pj.IsValid():
+			return pi.IsValid()
+		case positionLess(pi, pj):
+			return true
+		case positionLess(pj, pi):
+			return false
+		}
+		return unquote(sorted[i].Value) < unquote(sorted[j].Value)
+	})
+	return sorted
+}
+
+// earliest returns the first of the positions in the source order, the
+// zero position if there is none
+func earliest(positions []token.Position) token.Position {
+	var first token.Position
+	for _, pos := range positions {
+		if !first.IsValid() || positionLess(pos, first) {
+			first = pos
+		}
+	}
+	return first
+}
+
+// positionLess reports whether the position a precedes b
+func positionLess(a, b token.Position) bool {
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Column < b.Column
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// directiveArgs returns the arguments of the go:generate directive split
+// and unquoted the way the go command does
+func directiveArgs(t *testing.T, line string) []string {
+	t.Helper()
+
+	rest, ok := strings.CutPrefix(line, "//go:generate prep ")
+	if !ok {
+		t.Fatalf("%s isn't a directive of prep", line)
+	}
+
+	var args []string
+	for rest = strings.TrimLeft(rest, " "); rest != ""; rest = strings.TrimLeft(rest, " ") {
+		if rest[0] != '"' {
+			arg, tail, _ := strings.Cut(rest, " ")
+			args, rest = append(args, arg), tail
+			continue
+		}
+
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		arg, err := strconv.Unquote(quoted)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		args, rest = append(args, arg), rest[len(quoted):]
+	}
+	return args
+}
+
+func TestDirectiveRoundTrip(t *testing.T) {
+	// runFlags are the flags of the current run only, the directive
+	// doesn't reproduce them
+	runFlags := map[string]bool{"stdout": true, "check": true, "n": true, "v": true, "fail-fast": true}
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "output",
+			args: []string{"-o", "queries.go", "-filename", "store.go", "-pkg", "queries", "-var", "statements", "-format", "map"},
+		},
+		{
+			name: "dir",
+			args: []string{"-dir", "./queries", "-pkg", "queries", "-export=false"},
+		},
+		{
+			name: "explicit defaults",
+			args: []string{"-normalize=false", "-dialect", "none", "-export"},
+		},
+		{
+			name: "code",
+			args: []string{"-extract-sprintf", "-prepare-all", "-sqlx", "-struct", "-inventory", "-also-sql", "-statement-names", "-pgx", "-raw-strings", "-split-by-file", "-append-init", "-template", "my template.tmpl"},
+		},
+		{
+			name: "statements",
+			args: []string{"-normalize", "-dialect", "postgres", "-sort", "source", "-validate", "-deny", "ddl,delete", "-exclude-query", `^SELECT "a b"$`, "-exclude-query", `\d+,\s`, "-allow-empty", "-strict"},
+		},
+		{
+			name: "packages",
+			args: []string{"-tags", "a b", "-mod", "mod", "-modfile", `C:\go.mod`, "-goos", "linux", "-goarch", "arm64", "-include-tests", "-test-output", "-dynamic-lookups", "-include-generated"},
+		},
+		{
+			name: "build configurations",
+			args: []string{"-all-platforms", "-all-build-configs"},
+		},
+		{
+			name: "file",
+			args: []string{"-header", "header.txt", "-append", "-build-tag", "linux && !cgo", "-legacy-build-tags", "-config", "prep.json"},
+		},
+		{
+			name: "repeated",
+			args: []string{"-exclude", "*_gen.go", "-exclude", "legacy/*", "-sqldir", "sql", "-sqldir", "more sql", "-method", "Query:1", "-method", "Select", "-receiver", "*Store", "-receiver", "Repo"},
+		},
+	}
+
+	covered := map[string]bool{"f": true}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := parseOptions(t, append([]string{"-f", "example.com/store"}, test.args...)...)
+			line := directive("example.com/store", opts)
+			got := parseOptions(t, directiveArgs(t, line)...)
+
+			// go generate runs the directive in the directory of the
+			// generated file
+			if opts.dir != "" {
+				opts.dir = "."
+			}
+			if !reflect.DeepEqual(got, opts) {
+				t.Errorf("%s parses to\n%+v, want\n%+v", line, *got, *opts)
+			}
+		})
+		for name := range parseOptions(t, test.args...).setFlags {
+			covered[name] = true
+		}
+	}
+
+	fs := flag.NewFlagSet("prep", flag.ContinueOnError)
+	registerFlags(fs, &options{})
+	fs.VisitAll(func(f *flag.Flag) {
+		if !covered[f.Name] && !runFlags[f.Name] {
+			t.Errorf("-%s isn't round-tripped by the tests", f.Name)
+		}
+	})
+}
+
+func TestRawStringsRoundTrip(t *testing.T) {
+	corpus := []string{
+		"SELECT * FROM users WHERE name = 'O''Brien'",
+		`SELECT "id" FROM "users"`,
+		`SELECT '\n' AS newline, E'\\' AS backslash`,
+		"SELECT 'żółć', '日本語', '🦫' FROM émigrés",
+		"SELECT\tid,\tname\nFROM\tusers",
+		"SELECT * FROM users WHERE name LIKE 'a%' AND note LIKE '%%s%d'",
+		"SELECT `id` FROM `users`",
+		"SELECT id\r\nFROM users",
+		"SELECT '\\`' AS mixed, \"`\" AS quoted",
+		"SELECT 1\x00",
+		"\ufeffSELECT 1",
+		"SELECT '\xff'",
+		"",
+	}
+
+	var queries []query
+	for _, text := range corpus {
+		queries = append(queries, query{Value: strconv.Quote(text)})
+	}
+
+	tests := []struct {
+		name    string
+		queries []query
+		want    []string
+	}{
+		{
+			name:    "raw strings",
+			queries: rawQueries(queries),
+			want:    corpus,
+		},
+		{
+			// the normalization requotes the raw string literals
+			name:    "normalized raw strings",
+			queries: rewriteQueries(rawQueries(queries), normalize),
+			want: func() []string {
+				var texts []string
+				for _, text := range corpus {
+					texts = append(texts, normalize(text))
+				}
+				return texts
+			}(),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := generateCode(target{packageName: "store", varName: defaultVarName, declare: true}, test.queries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file, err := parser.ParseFile(token.NewFileSet(), "prepared_statements.go", code, 0)
+			if err != nil {
+				t.Fatalf("%v\n%s", err, code)
+			}
+
+			var got []string
+			raw := 0
+			ast.Inspect(file, func(n ast.Node) bool {
+				lit, ok := n.(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return true
+				}
+				text, err := strconv.Unquote(lit.Value)
+				if err != nil {
+					t.Errorf("%s: %v", lit.Value, err)
+				}
+				if strings.HasPrefix(lit.Value, "`") {
+					raw++
+				}
+				got = append(got, text)
+				return true
+			})
+
+			want := uniqueTexts(test.want)
+			if got = uniqueTexts(got); !reflect.DeepEqual(got, want) {
+				t.Errorf("got statements %q, want %q", got, want)
+			}
+			if raw == 0 {
+				t.Errorf("no raw string literal is generated:\n%s", code)
+			}
+		})
+	}
+}
+
+// uniqueTexts returns the sorted texts without the duplicates
+func uniqueTexts(texts []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, text := range texts {
+		if !seen[text] {
+			seen[text] = true
+			unique = append(unique, text)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+func TestExcludeQueries(t *testing.T) {
+	queries := []query{
+		{Value: strconv.Quote("CREATE TEMP TABLE scratch (id int)")},
+		{Value: "`SELECT  name\n\tFROM users`"},
+		{Value: strconv.Quote("DELETE FROM sessions")},
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		kept     []string
+		// excluded are the statements excluded followed by their
+		// patterns
+		excluded []string
+	}{
+		{
+			name: "none",
+			kept: []string{queries[0].Value, queries[1].Value, queries[2].Value},
+		},
+		{
+			// the patterns match the normalized statements
+			name:     "normalized",
+			patterns: []string{`^SELECT name FROM users$`},
+			kept:     []string{queries[0].Value, queries[2].Value},
+			excluded: []string{queries[1].Value, `^SELECT name FROM users$`},
+		},
+		{
+			// the first matching pattern is named
+			name:     "first pattern",
+			patterns: []string{`^DROP`, `(?i)^create temp`, `TABLE`, `^DELETE`},
+			kept:     []string{queries[1].Value},
+			excluded: []string{queries[0].Value, `(?i)^create temp`, queries[2].Value, `^DELETE`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var patterns []*regexp.Regexp
+			for _, pattern := range test.patterns {
+				patterns = append(patterns, regexp.MustCompile(pattern))
+			}
+
+			kept, excluded := excludeQueries(queries, patterns)
+			var gotKept, gotExcluded []string
+			for _, q := range kept {
+				gotKept = append(gotKept, q.Value)
+			}
+			for _, e := range excluded {
+				gotExcluded = append(gotExcluded, e.Value, e.pattern)
+			}
+			if !reflect.DeepEqual(gotKept, test.kept) {
+				t.Errorf("kept %q, want %q", gotKept, test.kept)
+			}
+			if !reflect.DeepEqual(gotExcluded, test.excluded) {
+				t.Errorf("excluded %q, want %q", gotExcluded, test.excluded)
+			}
+		})
+	}
+}
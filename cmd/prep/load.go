@@ -0,0 +1,287 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+var (
+	errPackageNotFound    = errors.New("package not found")
+	errPackageDirNotFound = errors.New("failed to detect the package directory")
+)
+
+type (
+	// packageGroup is a package together with its test variants,
+	// queries of all of them are generated into a single file
+	packageGroup struct {
+		// pkg is the package the file is generated for
+		pkg *packages.Package
+		// all holds pkg and its test variants
+		all []*packages.Package
+		// configs holds the build configurations the packages of all
+		// are loaded for, empty for the default one
+		configs []string
+	}
+)
+
+// platforms are the GOOS the packages are loaded for by -all-platforms,
+// the ones not supported on the host architecture carry their own
+var platforms = []string{
+	"aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios", "js",
+	"linux", "netbsd", "openbsd", "plan9", "solaris", "windows",
+}
+
+// platformArchs maps the GOOS to the GOARCH they are loaded with by
+// -all-platforms if the host architecture isn't supported by them
+var platformArchs = map[string]string{
+	"aix": "ppc64",
+	"js":  "wasm",
+}
+
+// loadConfig returns the configuration the packages are loaded with
+func loadConfig(opts *options) *packages.Config {
+	cfg := &packages.Config{Mode: packages.LoadSyntax, Tests: opts.includeTests}
+	if opts.goos != "" || opts.goarch != "" {
+		cfg.Env = os.Environ()
+		if opts.goos != "" {
+			cfg.Env = append(cfg.Env, "GOOS="+opts.goos)
+		}
+		if opts.goarch != "" {
+			cfg.Env = append(cfg.Env, "GOARCH="+opts.goarch)
+		}
+	}
+	if opts.tags != "" {
+		cfg.BuildFlags = append(cfg.BuildFlags, "-tags="+opts.tags)
+	}
+	if opts.mod != "" {
+		cfg.BuildFlags = append(cfg.BuildFlags, "-mod="+opts.mod)
+	}
+	if opts.modFile != "" {
+		cfg.BuildFlags = append(cfg.BuildFlags, "-modfile="+opts.modFile)
+	}
+
+	return cfg
+}
+
+// Load loads packages by their import paths, errors of the
+// individual packages are left for the caller to inspect
+func Load(cfg *packages.Config, paths ...string) ([]*packages.Package, error) {
+	pkgs, err := packages.Load(cfg, paths...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pkgs) < 1 {
+		return nil, errPackageNotFound
+	}
+
+	return pkgs, nil
+}
+
+// loadGroups loads the packages and groups them with their test
+// variants, with -all-platforms the groups hold the variants of every
+// platform the package type checks for, with -all-build-configs the
+// variants of every combination of the custom build tags selecting the
+// files left out of the default configuration
+func loadGroups(names []string, opts *options) ([]*packageGroup, error) {
+	if !opts.allPlatforms && !opts.allBuildConfigs {
+		pkgs, err := Load(loadConfig(opts), names...)
+		if err != nil {
+			return nil, err
+		}
+		return groupPackages(pkgs), nil
+	}
+
+	var (
+		groups []*packageGroup
+		byPath = map[string]*packageGroup{}
+		failed = map[string]string{}
+		fset   = token.NewFileSet()
+	)
+
+	// merge adds the packages loaded for the configuration to the
+	// groups, the ones failing to type check are left out
+	merge := func(config string, pkgs []*packages.Package) {
+		for _, g := range groupPackages(pkgs) {
+			all := g.all[:0]
+			for _, p := range g.all {
+				if len(p.Errors) > 0 {
+					log.Printf("prep: %s: warning: %s: skipped, %v", p.PkgPath, config, p.Errors[0])
+					failed[g.pkg.PkgPath] = config
+					continue
+				}
+				all = append(all, p)
+			}
+			if len(all) == 0 {
+				continue
+			}
+
+			configs := make([]string, len(all))
+			for i := range configs {
+				configs[i] = config
+			}
+
+			existing, ok := byPath[g.pkg.PkgPath]
+			if !ok {
+				g.all, g.configs = all, configs
+				byPath[g.pkg.PkgPath] = g
+				groups = append(groups, g)
+				continue
+			}
+			existing.all = append(existing.all, all...)
+			existing.configs = append(existing.configs, configs...)
+		}
+	}
+
+	if opts.allBuildConfigs {
+		cfg := loadConfig(opts)
+		cfg.Fset = fset
+		pkgs, err := Load(cfg, names...)
+		if err != nil {
+			return nil, err
+		}
+		merge("default tags", pkgs)
+
+		for _, tags := range buildConfigs(pkgs, opts) {
+			configOpts := *opts
+			configOpts.tags = tags
+			if opts.tags != "" {
+				configOpts.tags = opts.tags + "," + tags
+			}
+
+			cfg := loadConfig(&configOpts)
+			cfg.Fset = fset
+			pkgs, err := Load(cfg, names...)
+			if err != nil {
+				log.Printf("prep: warning: tags %s: %v", tags, err)
+				continue
+			}
+			merge("tags "+tags, pkgs)
+		}
+	}
+
+	if opts.allPlatforms {
+		for _, goos := range hostFirst(platforms) {
+			platformOpts := *opts
+			platformOpts.goos, platformOpts.goarch = goos, opts.goarch
+			if arch, ok := platformArchs[goos]; ok {
+				platformOpts.goarch = arch
+			}
+
+			cfg := loadConfig(&platformOpts)
+			cfg.Fset = fset
+			pkgs, err := Load(cfg, names...)
+			if err != nil {
+				log.Printf("prep: warning: GOOS=%s: %v", goos, err)
+				continue
+			}
+			merge("GOOS="+goos, pkgs)
+		}
+	}
+
+	for path, config := range failed {
+		if _, ok := byPath[path]; !ok {
+			return nil, fmt.Errorf("%s: fails to type check for any build configuration, last %s", path, config)
+		}
+	}
+
+	if len(groups) == 0 {
+		return nil, errPackageNotFound
+	}
+
+	return groups, nil
+}
+
+// hostFirst returns the platforms with the GOOS of the host first, the
+// packages of the host are preferred
+func hostFirst(platforms []string) []string {
+	sorted := []string{runtime.GOOS}
+	for _, goos := range platforms {
+		if goos != runtime.GOOS {
+			sorted = append(sorted, goos)
+		}
+	}
+	return sorted
+}
+
+// groupPackages groups the loaded packages with their test variants,
+// the generated test main packages are dropped
+func groupPackages(pkgs []*packages.Package) []*packageGroup {
+	var (
+		groups []*packageGroup
+		byPath = map[string]*packageGroup{}
+	)
+
+	for _, p := range pkgs {
+		if p.Name == "main" && strings.HasSuffix(p.ID, ".test") {
+			continue
+		}
+
+		path := strings.TrimSuffix(p.PkgPath, "_test")
+		g, ok := byPath[path]
+		if !ok {
+			g = &packageGroup{pkg: p}
+			byPath[path] = g
+			groups = append(groups, g)
+		}
+
+		// prefer the package itself over its test variants
+		if p.ID == p.PkgPath {
+			g.pkg = p
+		}
+		g.all = append(g.all, p)
+	}
+
+	return groups
+}
+
+// AST returns package's abstract syntax tree made of the files the
+// package was type checked with, positions are relative to p.Fset
+func AST(p *packages.Package) (*ast.Package, error) {
+	if len(p.Syntax) != len(p.CompiledGoFiles) {
+		return nil, fmt.Errorf("syntax of %d of %d files is missing", len(p.CompiledGoFiles)-len(p.Syntax), len(p.CompiledGoFiles))
+	}
+
+	ap := &ast.Package{Name: p.Name, Files: make(map[string]*ast.File, len(p.Syntax))}
+	for _, file := range p.Syntax {
+		ap.Files[p.Fset.Position(file.Package).Filename] = file
+	}
+
+	return ap, nil
+}
+
+// sortedFiles returns the files of the package sorted by their names
+func sortedFiles(ap *ast.Package) []*ast.File {
+	names := make([]string, 0, len(ap.Files))
+	for name := range ap.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]*ast.File, 0, len(names))
+	for _, name := range names {
+		files = append(files, ap.Files[name])
+	}
+	return files
+}
+
+// Dir returns absolute path of the package in a filesystem
+func Dir(p *packages.Package) (string, error) {
+	for _, files := range [][]string{p.GoFiles, p.CompiledGoFiles, p.OtherFiles} {
+		if len(files) > 0 {
+			return filepath.Dir(files[0]), nil
+		}
+	}
+
+	return "", errPackageDirNotFound
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+)
+
+// markers of the manually curated statements kept by -append
+const (
+	manualBeginMarker = "// prep:manual-begin"
+	manualEndMarker   = "// prep:manual-end"
+)
+
+type (
+	// manualEntry is an element of the generated composite literal
+	// placed between the manual markers
+	manualEntry struct {
+		// text is the source of the element
+		text string
+		// value is the Go literal of the statement
+		value string
+		// key is the unquoted key of the element of the map, empty
+		// for the slice
+		key string
+		// pos is the position of the element in the generated file
+		pos token.Position
+	}
+
+	// manualSection holds the manually curated statements of the
+	// generated file
+	manualSection struct {
+		// found reports whether the file has the markers
+		found   bool
+		entries []manualEntry
+	}
+)
+
+// readManualSection returns the manually curated statements of the
+// generated file, a missing file has none
+func readManualSection(outputPath string) (manualSection, error) {
+	code, err := os.ReadFile(outputPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manualSection{}, nil
+		}
+		return manualSection{}, fmt.Errorf("failed to read the generated file: %v", err)
+	}
+
+	section, err := parseManualSection(outputPath, code)
+	if err != nil {
+		return manualSection{}, fmt.Errorf("failed to read manual statements of %s: %v", outputPath, err)
+	}
+	return section, nil
+}
+
+// parseManualSection returns the elements of the composite literal
+// placed between the manual markers of the code of the named file
+func parseManualSection(fileName string, code []byte) (manualSection, error) {
+	fs := token.NewFileSet()
+	file, err := parser.ParseFile(fs, fileName, code, parser.ParseComments)
+	if err != nil {
+		return manualSection{}, err
+	}
+
+	var begin, end token.Pos
+	for _, group := range file.Comments {
+		for _, c := range group.List {
+			switch c.Text {
+			case manualBeginMarker:
+				if begin.IsValid() {
+					return manualSection{}, errors.New("duplicate " + manualBeginMarker + " marker")
+				}
+				begin = c.End()
+			case manualEndMarker:
+				if end.IsValid() {
+					return manualSection{}, errors.New("duplicate " + manualEndMarker + " marker")
+				}
+				end = c.Pos()
+			}
+		}
+	}
+
+	switch {
+	case !begin.IsValid() && !end.IsValid():
+		return manualSection{}, nil
+	case !begin.IsValid() || !end.IsValid() || end < begin:
+		return manualSection{}, errors.New("unbalanced " + manualBeginMarker + " and " + manualEndMarker + " markers")
+	}
+
+	section := manualSection{found: true}
+	ast.Inspect(file, func(node ast.Node) bool {
+		lit, ok := node.(*ast.CompositeLit)
+		if !ok {
+			return true
+		}
+
+		for _, elt := range lit.Elts {
+			if elt.Pos() < begin || elt.End() > end {
+				continue
+			}
+
+			pos := fs.Position(elt.Pos())
+			entry := manualEntry{text: string(code[pos.Offset:fs.Position(elt.End()).Offset]), pos: pos}
+			value := elt
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				value = kv.Value
+				if key, ok := kv.Key.(*ast.BasicLit); ok && key.Kind == token.STRING {
+					entry.key = unquote(key.Value)
+				}
+			}
+			if q, ok := value.(*ast.BasicLit); ok {
+				entry.value = q.Value
+			}
+			section.entries = append(section.entries, entry)
+		}
+		return false
+	})
+
+	return section, nil
+}
+
+// without returns the section without the entries which keys and
+// statements are among the queries or the preceding entries, the
+// entries of the slice are keyed by their statements, a key of the map
+// shared by distinct statements is an error
+func (s manualSection) without(queries []query) (manualSection, error) {
+	type origin struct {
+		value string
+		pos   token.Position
+	}
+	keys := make(map[string]origin, len(queries))
+	values := make(map[string]struct{}, len(queries))
+	for _, q := range queries {
+		keys[queryKey(q)] = origin{value: unquote(q.Value), pos: earliest(q.Pos)}
+		values[unquote(q.Value)] = struct{}{}
+	}
+
+	kept := manualSection{found: s.found}
+	for _, entry := range s.entries {
+		value := unquote(entry.value)
+		if entry.key == "" {
+			if _, ok := values[value]; ok && entry.value != "" {
+				continue
+			}
+			if entry.value != "" {
+				values[value] = struct{}{}
+			}
+			kept.entries = append(kept.entries, entry)
+			continue
+		}
+
+		if o, ok := keys[entry.key]; ok {
+			if o.value == value && entry.value != "" {
+				continue
+			}
+			return manualSection{}, fmt.Errorf("%s: manual statement %s has the key of the statement at %s", entry.pos, entry.text, o.pos)
+		}
+		keys[entry.key] = origin{value: value, pos: entry.pos}
+		kept.entries = append(kept.entries, entry)
+	}
+	return kept, nil
+}
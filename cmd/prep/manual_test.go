@@ -0,0 +1,108 @@
+package main
+
+import (
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestManualWithout(t *testing.T) {
+	queries := []query{
+		{Value: strconv.Quote("SELECT name FROM users"), Name: "selectUsers", Pos: []token.Position{{Filename: "store.go", Line: 7, Column: 2}}},
+		{Value: strconv.Quote("DELETE FROM sessions"), Pos: []token.Position{{Filename: "store.go", Line: 9, Column: 2}}},
+	}
+	literal := queryKey(queries[1])
+
+	tests := []struct {
+		name  string
+		value string
+		kept  []string
+		// err is the substrings of the error, empty if none
+		err []string
+	}{
+		{
+			// the entries of the slice are deduplicated by their
+			// statements
+			name: "slice",
+			value: `[]string{
+	// prep:manual-begin
+	"SELECT name FROM users",
+	"SELECT 1",
+	"SELECT 1",
+	manualQuery,
+	// prep:manual-end
+}`,
+			kept: []string{`"SELECT 1"`, `manualQuery`},
+		},
+		{
+			// the entries of the map are dropped only if both the keys
+			// and the statements repeat
+			name: "map",
+			value: `map[string]string{
+	// prep:manual-begin
+	"selectUsers": "SELECT name FROM users",
+	"` + literal + `": "DELETE FROM sessions",
+	"listUsers": "SELECT name FROM users",
+	"ping": "SELECT 1",
+	"ping": "SELECT 1",
+	// prep:manual-end
+}`,
+			kept: []string{`"listUsers": "SELECT name FROM users"`, `"ping": "SELECT 1"`},
+		},
+		{
+			name: "key of a discovered statement",
+			value: `map[string]string{
+	// prep:manual-begin
+	"selectUsers": "SELECT id FROM users",
+	// prep:manual-end
+}`,
+			err: []string{"prepared_statements.go:6:2", `"selectUsers": "SELECT id FROM users"`, "store.go:7:2"},
+		},
+		{
+			name: "key of a manual statement",
+			value: `map[string]string{
+	// prep:manual-begin
+	"ping": "SELECT 1",
+	"ping": "SELECT 2",
+	// prep:manual-end
+}`,
+			err: []string{"prepared_statements.go:7:2", "prepared_statements.go:6:2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code := "package store\n\nfunc init() {\n\tprepStatements = " + test.value + "\n}\n"
+			section, err := parseManualSection("prepared_statements.go", []byte(code))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			kept, err := section.without(queries)
+			if len(test.err) > 0 {
+				if err == nil {
+					t.Fatalf("no error, want %q", test.err)
+				}
+				for _, want := range test.err {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("error %q doesn't name %s", err, want)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, entry := range kept.entries {
+				got = append(got, entry.text)
+			}
+			if !reflect.DeepEqual(got, test.kept) {
+				t.Errorf("kept %q, want %q", got, test.kept)
+			}
+		})
+	}
+}
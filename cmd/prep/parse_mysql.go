@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"sync"
+
+	"vitess.io/vitess/go/vt/sqlparser"
+)
+
+var (
+	// mysqlParser is the vitess parser validating the mysql statements
+	mysqlParser     *sqlparser.Parser
+	mysqlParserErr  error
+	mysqlParserOnce sync.Once
+)
+
+// parseMySQL returns the error of the vitess parser parsing the
+// statement
+func parseMySQL(sql string) error {
+	mysqlParserOnce.Do(func() {
+		mysqlParser, mysqlParserErr = sqlparser.New(sqlparser.Options{})
+	})
+	if mysqlParserErr != nil {
+		return mysqlParserErr
+	}
+
+	if _, err := mysqlParser.Parse(sql); err != nil {
+		// the vitess errors print their codes and stacks with %v
+		return errors.New(err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+//go:build cgo
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	pgquery "github.com/pganalyze/pg_query_go/v6"
+	"github.com/pganalyze/pg_query_go/v6/parser"
+)
+
+func init() {
+	dialectParsers[dialectPostgres] = parsePostgres
+}
+
+// parsePostgres returns the error of the postgres parser of pg_query
+// parsing the statement, the error is prefixed with the offset of the
+// byte it is found at
+func parsePostgres(sql string) error {
+	_, err := pgquery.Parse(sql)
+
+	var parseErr *parser.Error
+	if !errors.As(err, &parseErr) || parseErr.Cursorpos <= 0 {
+		return err
+	}
+
+	// the cursor counts the characters from one
+	offset := 0
+	for i := 1; i < parseErr.Cursorpos && offset < len(sql); i++ {
+		_, size := utf8.DecodeRuneInString(sql[offset:])
+		offset += size
+	}
+	return fmt.Errorf("offset %d: %s", offset, parseErr.Message)
+}
@@ -1,245 +1,1591 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"flag"
 	"fmt"
 	"go/ast"
-	"go/build"
+	"go/build/constraint"
+	"go/format"
 	"go/parser"
 	"go/token"
 	"go/types"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"golang.org/x/tools/go/packages"
 )
 
+const (
+	defaultOutputFileName = "prepared_statements.go"
+	defaultVarName        = "prepStatements"
+)
+
+// exit codes of the tool
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	// exitUnreachable is returned if the database the statements are
+	// prepared against can't be reached
+	exitUnreachable = 3
+)
+
 type (
-	queryFinder struct {
-		packageInfo    map[string]string
-		queries        []string
-		nonUniqueNames map[string]struct{}
+	// options holds the command line options shared by all of the
+	// packages processed in a single run
+	options struct {
+		sourcePackageNames listFlag
+		outputFileName     string
+		// fileName is the base name of the file generated into the
+		// package directory, empty for the default of the format
+		fileName string
+		// dir is the directory the file is generated into instead of
+		// the package directory
+		dir string
+		// pkg is the name of the package generated into dir, the
+		// base name of dir by default
+		pkg     string
+		varName string
+		// skipEmpty makes packages without queries to be skipped
+		// unless they already have a generated file
+		skipEmpty bool
+		// stdout makes the generated code to be printed to the
+		// standard output instead of being written to the file
+		stdout bool
+		// check makes the tool to fail if the generated file
+		// differs from the one on disk, nothing is written
+		check bool
+		// dryRun makes the tool to print the pending changes of
+		// the generated file, nothing is written
+		dryRun bool
+		// verbose enables logging of every discovered call site
+		verbose bool
+		// tags are the build tags the packages are loaded with
+		tags string
+		// includeTests makes the test files of the packages to be
+		// scanned too
+		includeTests bool
+		// testOutput makes the generated file to be a test file
+		testOutput bool
+		// exclude holds the glob patterns of the files not to scan
+		exclude listFlag
+		// sqlDirs holds the directories of the .sql files which
+		// statements are generated too
+		sqlDirs listFlag
+		// includeGenerated makes the files carrying the Code generated
+		// header to be scanned
+		includeGenerated bool
+		// dynamicLookups makes the lookups of the query containers by
+		// the keys which aren't constant to be reported as dynamic
+		dynamicLookups bool
+		// methods holds the additional method matchers
+		methods methodFlag
+		// receivers holds the import path qualified names of the
+		// additional receiver types of the built-in method matchers
+		receivers listFlag
+		// format is the representation of the generated output
+		format string
+		// failFast makes the run to stop at the first package that
+		// fails to generate
+		failFast bool
+		// mod is the module download mode, see go help modules
+		mod string
+		// modFile is the alternate go.mod file to load the packages with
+		modFile string
+		// goos and goarch override the platform the packages are
+		// loaded for
+		goos   string
+		goarch string
+		// allPlatforms makes the packages to be loaded for every
+		// supported GOOS, the queries of all of them are generated
+		allPlatforms bool
+		// allBuildConfigs makes the packages to be loaded for every
+		// combination of the custom build tags selecting their files,
+		// the queries of all of them are generated
+		allBuildConfigs bool
+		// headerFile is the file with the text emitted as a comment
+		// at the top of the generated Go code
+		headerFile string
+		// normalize makes the runs of whitespace of the statements
+		// to be collapsed
+		normalize bool
+		// extractSprintf makes the constant format strings of the
+		// queries formatted by fmt.Sprintf to be generated too
+		extractSprintf bool
+		// prepareAll makes the function preparing the statements
+		// against a *sql.DB to be generated too
+		prepareAll bool
+		// sqlx makes the function preparing the statements against
+		// a *sqlx.DB to be generated too
+		sqlx bool
+		// statementsStruct makes the struct with a field per constant
+		// holding a statement to be generated too
+		statementsStruct bool
+		// export exports the generated functions and types, they are
+		// exported with -dir unless it's set explicitly
+		export bool
+		// inventory makes the JSON inventory of the statements to be
+		// written next to the Go code too
+		inventory bool
+		// alsoSQL makes the SQL file of the statements to be written
+		// next to the Go code too
+		alsoSQL bool
+		// statementIDs makes the stable identifiers of the statements
+		// to be generated too
+		statementIDs bool
+		// pgx makes the pgx hook preparing the statements by their
+		// stable names to be generated into a file of its own
+		pgx bool
+		// rawStrings makes the statements to be emitted as raw string
+		// literals whenever they can be
+		rawStrings bool
+		// splitByFile makes the statements of every source file to be
+		// generated into a file of its own
+		splitByFile bool
+		// appendInit makes the generated init to append the statements
+		// to the variable instead of assigning it
+		appendInit bool
+		// templateFile is the text/template file the generated file
+		// is executed from instead of the format
+		templateFile string
+		// dialect is the SQL dialect the placeholders of the
+		// statements are rewritten to
+		dialect string
+		// sort is the order of the emitted statements
+		sort string
+		// validate makes the generation to fail if a statement is
+		// malformed
+		validate bool
+		// deny holds the statement kinds that fail the generation
+		deny listFlag
+		// excludeQueries holds the patterns of the statements dropped
+		// from the output
+		excludeQueries patternFlag
+		// excludeRegexps holds the compiled excludeQueries
+		excludeRegexps []*regexp.Regexp
+		// appendManual makes the manually curated statements of the
+		// generated file to be kept
+		appendManual bool
+		// buildTag is the build constraint expression of the generated
+		// Go code
+		buildTag string
+		// legacyBuildTags makes the // +build lines of the constraint
+		// to be emitted too
+		legacyBuildTags bool
+		// allowEmpty allows the generation of the code without queries
+		allowEmpty bool
+		// strict makes the generation to fail if a query of a matched
+		// call can't be extracted
+		strict bool
+		// driver and dsn select the database the statements are
+		// prepared against
+		driver string
+		dsn    string
+		// prepareTimeout is the time a statement may take to be
+		// prepared
+		prepareTimeout time.Duration
+		// json makes the document describing the run to be printed
+		// to the standard output
+		json bool
+		// report is the format of the report of the matched calls
+		// printed instead of generating the code, empty if disabled
+		report reportFlag
+		// configFile is the configuration file of all of the
+		// packages, empty to discover it for every package
+		configFile string
+		// setFlags holds the names of the flags set explicitly, they
+		// override the configuration file
+		setFlags map[string]bool
+		// watch makes the tool to regenerate the code whenever the
+		// source packages change
+		watch bool
 	}
+
+	// runResult is the outcome of a single run over the source packages
+	runResult struct {
+		exitCode int
+		// queries is the total number of the generated statements
+		queries int
+		// dirs holds the directories of the source packages
+		dirs []string
+		// reports holds the reports of the source packages
+		reports []packageReport
+		// outputs holds the paths of the generated files
+		outputs []string
+	}
+
+	// packageReport is the outcome of the generation for a package
+	packageReport struct {
+		pkgPath string
+		// outputPath is the path of the generated file
+		outputPath string
+		// written reports whether the file was written
+		written bool
+		// queries is the number of the generated statements
+		queries int
+		// statements holds the generated statements
+		statements []query
+		sites      []callSite
+		err        error
+		// checksum is the checksum of the statements of the generated
+		// file
+		checksum string
+		// excluded maps the patterns of -exclude-query to the numbers
+		// of the statements they excluded
+		excluded map[string]int
+	}
+
+	// methodFlag is a flag.Value collecting the Name:argIndex method
+	// matchers of a repeatable flag
+	methodFlag map[string]int
+
+	// listFlag is a flag.Value collecting the values of a repeatable
+	// flag, every value may also be a comma separated list
+	listFlag []string
+
+	// patternFlag is a flag.Value collecting the values of a repeatable
+	// flag as they are, i.e. the regular expressions holding commas
+	patternFlag []string
 )
 
+// String implements flag.Value interface
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value interface
+func (l *listFlag) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+// String implements flag.Value interface
+func (p *patternFlag) String() string {
+	return strings.Join(*p, " ")
+}
+
+// Set implements flag.Value interface
+func (p *patternFlag) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// String implements flag.Value interface
+func (m *methodFlag) String() string {
+	return strings.Join(m.args(), ",")
+}
+
+// Set implements flag.Value interface
+func (m *methodFlag) Set(value string) error {
+	name, index, ok := strings.Cut(value, ":")
+	if !token.IsIdentifier(name) {
+		return fmt.Errorf("method matcher %q must be of the form Name:argIndex or Name", value)
+	}
+
+	i := autoIndex
+	if ok {
+		var err error
+		if i, err = strconv.Atoi(index); err != nil || i < 0 {
+			return fmt.Errorf("argument index of the method matcher %q must be a non-negative integer", value)
+		}
+	}
+
+	if *m == nil {
+		*m = methodFlag{}
+	}
+	(*m)[name] = i
+	return nil
+}
+
+// args returns the Name:argIndex matchers sorted by the method name,
+// the matchers detecting the index are given by the name only
+func (m *methodFlag) args() []string {
+	var args []string
+	for name, index := range *m {
+		if index == autoIndex {
+			args = append(args, name)
+			continue
+		}
+		args = append(args, fmt.Sprintf("%s:%d", name, index))
+	}
+	sort.Strings(args)
+	return args
+}
+
 func main() {
-	var (
-		sourcePackageName = flag.String("f", "", "source package import path, i.e. github.com/my/package")
-	)
+	os.Exit(run())
+}
+
+// run runs the tool and returns its exit code, every fatal path
+// returns from here so the deferred cleanups are executed
+func run() int {
+	var opts options
+
+	// the flags the linked packages define, i.e. the glog ones of the
+	// vitess parser, aren't flags of the tool
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	registerFlags(flag.CommandLine, &opts)
+	flag.BoolVar(&opts.watch, "watch", false, "regenerate the code whenever the Go files of the source packages change")
+	printVersionOnly := flag.Bool("version", false, "print the version of the tool and exit")
+	listFileName := flag.String("list", "", "file with the import paths or patterns of the source packages, one per line, - for the standard input")
+	flag.Var(&opts.report, "report", "print the report of the matched calls grouped by the extraction outcome instead of generating the code, -report=json prints it as JSON")
+	flag.StringVar(&opts.driver, "driver", "", "database/sql driver of -dsn, postgres or mysql")
+	flag.StringVar(&opts.dsn, "dsn", "", "data source name of the scratch database every statement is prepared against, the run fails if any statement fails to prepare")
+	flag.DurationVar(&opts.prepareTimeout, "prepare-timeout", defaultPrepareTimeout, "time a statement may take to be prepared by -dsn")
+	flag.BoolVar(&opts.json, "json", false, "print the JSON document describing the packages, queries, unresolved calls and generated files of the run to the standard output, logs go to the standard error")
+	discover := flag.Bool("discover", false, "generate the code for every package matching the patterns given as arguments, default ./..., using the flags of their go:generate prep directives")
 	flag.Parse()
+	opts.setFlags = setFlags(flag.CommandLine)
 
-	if *sourcePackageName == "" {
-		flag.PrintDefaults()
-		return
+	if *printVersionOnly {
+		printVersion(os.Stdout)
+		return exitOK
 	}
 
-	var (
-		sourcePackage *packages.Package
-		astPackage    *ast.Package
-		fs            *token.FileSet
-		err           error
-	)
+	if *discover {
+		patterns := flag.Args()
+		if len(patterns) == 0 {
+			patterns = []string{"./..."}
+		}
+		return finish(discoverAndGenerate(patterns, &opts), &opts)
+	}
 
-	if sourcePackage, err = Load(*sourcePackageName); err != nil {
-		log.Fatalf("prep: %v", err)
+	if *listFileName != "" {
+		names, err := readPackageList(*listFileName)
+		if err != nil {
+			return fatalf("%v", err)
+		}
+		opts.sourcePackageNames = append(opts.sourcePackageNames, names...)
 	}
 
-	fs = token.NewFileSet()
-	if astPackage, err = AST(fs, sourcePackage); err != nil {
-		log.Fatalf("failed to load package sources: %v", err)
+	if len(opts.sourcePackageNames) == 0 {
+		return usageError("no source packages, use -f or -list")
 	}
 
-	finder := &queryFinder{
-		packageInfo:    map[string]string{},
-		nonUniqueNames: map[string]struct{}{},
+	if err := validateOptions(&opts); err != nil {
+		return usageError("%v", err)
 	}
 
-	for k, v := range sourcePackage.TypesInfo.Defs {
-		if constant, ok := v.(*types.Const); ok {
-			if _, ok = finder.packageInfo[k.Name]; ok {
-				finder.nonUniqueNames[k.Name] = struct{}{}
-				continue
-			}
-			finder.packageInfo[k.Name] = constant.Val().ExactString()
+	if opts.watch && (opts.check || opts.dryRun || opts.stdout || opts.report != "" || opts.json) {
+		return usageError("-watch can't be combined with -check, -stdout, -n, -report or -json")
+	}
+
+	if opts.watch {
+		return watch(opts.sourcePackageNames, &opts)
+	}
+
+	return finish(generateAll(opts.sourcePackageNames, &opts), &opts)
+}
+
+// finish prints the report or the JSON document of the run if
+// requested and returns its exit code
+func finish(result runResult, opts *options) int {
+	if opts.json {
+		if err := writeRunJSON(os.Stdout, result); err != nil {
+			return fatalf("failed to write JSON document: %v", err)
 		}
+		return result.exitCode
 	}
 
-	for _, file := range astPackage.Files {
-		ast.Walk(finder, file)
+	if opts.report == "" {
+		return result.exitCode
 	}
 
-	path, err := getPathToPackage(*sourcePackageName)
-	if err != nil {
-		log.Fatalf("prep: %v", err)
+	if err := writeReport(os.Stdout, string(opts.report), result.reports); err != nil {
+		return fatalf("failed to write report: %v", err)
 	}
 
-	outputFileName := filepath.Join(path, "prepared_statements.go")
+	return result.exitCode
+}
 
-	queries := uniqueStrings(finder.queries)
-	code := generateCode(astPackage.Name, *sourcePackageName, queries)
-	file, err := os.Create(outputFileName)
-	if err != nil {
-		log.Fatalf("prep: failed to create file: %v", err)
+// registerFlags defines the flags configuring the generation of the
+// code, the flags are shared by the command line and the go:generate
+// directives
+func registerFlags(fs *flag.FlagSet, opts *options) {
+	fs.Var(&opts.sourcePackageNames, "f", "source package import path, directory or pattern, i.e. github.com/my/package, ./store or ./..., may be repeated or comma separated")
+	fs.StringVar(&opts.outputFileName, "o", "", "output file name, relative to the package directory or absolute (default depends on -format, "+defaultOutputFileName+" for Go code)")
+	fs.StringVar(&opts.fileName, "filename", "", "base name of the file generated into every package directory, must end in .go and not in _test.go for Go code (default "+defaultOutputFileName+")")
+	fs.StringVar(&opts.dir, "dir", "", "directory to generate the file into instead of the package directory, the variable is then declared and exported")
+	fs.StringVar(&opts.pkg, "pkg", "", "name of the package generated into -dir (default the base name of -dir)")
+	fs.StringVar(&opts.varName, "var", defaultVarName, "name of the variable the generated code assigns the statements to")
+	fs.BoolVar(&opts.stdout, "stdout", false, "print generated code to the standard output instead of writing the file")
+	fs.BoolVar(&opts.check, "check", false, "fail with a diff if the generated file is missing or out of date, nothing is written")
+	fs.BoolVar(&opts.dryRun, "n", false, "print added and removed queries and the diff of the generated file, nothing is written")
+	fs.BoolVar(&opts.verbose, "v", false, "log every discovered call site and a summary of the run")
+	fs.StringVar(&opts.tags, "tags", "", "comma separated list of build tags to load the packages with")
+	fs.BoolVar(&opts.includeTests, "include-tests", false, "scan the test files of the packages too, including the external test packages")
+	fs.BoolVar(&opts.testOutput, "test-output", false, "generate a _test.go file instead of a regular one")
+	fs.Var(&opts.exclude, "exclude", "glob pattern of the file base names or package relative paths not to scan, may be repeated")
+	fs.Var(&opts.sqlDirs, "sqldir", "directory, relative to the package directory or absolute, of the .sql files which statements are generated too, may be repeated")
+	fs.BoolVar(&opts.dynamicLookups, "dynamic-lookups", false, "report the lookups of the package slices and maps of the queries by the keys which aren't constant as dynamic instead of generating all of their queries")
+	fs.BoolVar(&opts.includeGenerated, "include-generated", false, "scan the files carrying the \"Code generated ... DO NOT EDIT.\" comment too, the file generated by the tool is never scanned")
+	fs.Var(&opts.methods, "method", "additional method matcher of the form Name:argIndex, i.e. RunQuery:1, or Name detecting the index of the query as the first string parameter of the method, matched on any receiver, may be repeated")
+	fs.Var(&opts.receivers, "receiver", "additional receiver type of the built-in methods of the form import/path.Name, i.e. example.com/cache.DB, may be repeated, the DB, Tx and Conn of database/sql and sqlx are always matched")
+	fs.StringVar(&opts.format, "format", formatSlice, "output format: slice, map (keyed by constant names), json, sql, yaml or md (Markdown documentation)")
+	fs.StringVar(&opts.mod, "mod", "", "module download mode to load the packages with: readonly, vendor or mod")
+	fs.StringVar(&opts.modFile, "modfile", "", "alternate go.mod file to load the packages with")
+	fs.StringVar(&opts.headerFile, "header", "", "file with the text, i.e. a license, emitted as a comment at the top of the generated Go code")
+	fs.BoolVar(&opts.normalize, "normalize", false, "collapse the runs of whitespace of the statements outside of their string literals and comments")
+	fs.BoolVar(&opts.prepareAll, "prepare-all", false, "generate the prepareAll function preparing every statement against a *sql.DB into the Go code, exported as PrepareAll with -dir or -export")
+	fs.BoolVar(&opts.sqlx, "sqlx", false, "generate the prepareAllx function preparing every statement against a *sqlx.DB into the Go code, the statements with named parameters are prepared as named statements, exported as PrepareAllx with -dir or -export")
+	fs.BoolVar(&opts.statementsStruct, "struct", false, "generate the statements struct with a *sql.Stmt field per constant holding a statement and the newStatements function preparing them into the Go code, exported as Statements and NewStatements with -dir or -export")
+	fs.BoolVar(&opts.export, "export", false, "export the functions and types generated by -prepare-all, -sqlx, -struct, -statement-names and -pgx, -export=false keeps them unexported with -dir (default true with -dir)")
+	fs.BoolVar(&opts.inventory, "inventory", false, "write the JSON inventory of the statements with their hashes, dialect and positions next to the Go code too, i.e. prepared_statements.json, -check covers it")
+	fs.BoolVar(&opts.alsoSQL, "also-sql", false, "write the SQL file of the statements next to the Go code too, i.e. prepared_statements.sql, -check covers it")
+	fs.BoolVar(&opts.statementIDs, "statement-names", false, "generate the map of the stable names of the statements, q_ and 12 hex digits of the hash of their normalized text, i.e. for the named prepared statements of pgx, and the constants of the names of the statements held by constants into the Go code")
+	fs.BoolVar(&opts.pgx, "pgx", false, "generate the prepareOnConnect hook of pgxpool.Config.AfterConnect preparing the statements by the names of -statement-names, which it implies, into a file of its own, i.e. prepared_statements_pgx.go")
+	fs.BoolVar(&opts.rawStrings, "raw-strings", false, "emit the statements as raw string literals unless they hold backticks or carriage returns")
+	fs.BoolVar(&opts.splitByFile, "split-by-file", false, "generate the statements first found in every source file into a file of its own appending them to the variable, i.e. prepared_statements_user.go, the files of the source files without statements are removed")
+	fs.BoolVar(&opts.appendInit, "append-init", false, "make the generated init append the statements to the variable instead of assigning it, so that the statements the other files of the package register are kept, nothing is generated without statements")
+	fs.StringVar(&opts.templateFile, "template", "", "text/template file to generate the Go code from instead of the default template, executed with the Data of github.com/wayfarer-games/prep/tmpl, the output is formatted by gofmt if -o ends with .go")
+	fs.BoolVar(&opts.extractSprintf, "extract-sprintf", false, "generate the constant format strings of the queries formatted by fmt.Sprintf into the formatTemplates variable of the Go code")
+	fs.StringVar(&opts.dialect, "dialect", dialectNone, "SQL dialect to rewrite the placeholders of the statements to: postgres ($1), mysql or sqlite (?), none keeps them")
+	fs.StringVar(&opts.sort, "sort", sortAlpha, "order of the emitted statements: alpha or source, by the file and line of their first occurrence")
+	fs.BoolVar(&opts.validate, "validate", false, "fail if a statement is malformed, the statements of -dialect postgres and mysql are parsed by pg_query and the vitess parser, the constants annotated with "+noValidateDirective+" are not validated")
+	fs.Var(&opts.excludeQueries, "exclude-query", "RE2 pattern of the statements, unquoted and normalized, dropped from the output, the report lists their calls as excluded, may be repeated")
+	fs.Var(&opts.deny, "deny", "comma separated statement kinds failing the generation: ddl, dml, dcl or leading keywords, i.e. delete or truncate")
+	fs.StringVar(&opts.buildTag, "build-tag", "", "build constraint expression emitted as the //go:build line of the generated Go code, i.e. !noprep")
+	fs.BoolVar(&opts.legacyBuildTags, "legacy-build-tags", false, "emit the // +build lines of -build-tag too")
+	fs.BoolVar(&opts.appendManual, "append", false, "keep the statements placed between the "+manualBeginMarker+" and "+manualEndMarker+" markers of the generated Go code")
+	fs.BoolVar(&opts.allowEmpty, "allow-empty", false, "allow the generation of the code without queries, otherwise a package without queries fails")
+	fs.StringVar(&opts.goos, "goos", "", "GOOS to load the packages for (default the host one)")
+	fs.StringVar(&opts.goarch, "goarch", "", "GOARCH to load the packages for (default the host one)")
+	fs.BoolVar(&opts.allPlatforms, "all-platforms", false, "load the packages for every supported GOOS and generate the queries of all of them")
+	fs.BoolVar(&opts.allBuildConfigs, "all-build-configs", false, "load the packages for every combination of the custom build tags of their files, i.e. postgres or mysql, and generate the queries of all of them")
+	fs.BoolVar(&opts.strict, "strict", false, "fail if the query of a matched call is neither a string literal nor a constant")
+	fs.StringVar(&opts.configFile, "config", "", "configuration file of the packages (default "+strings.Join(configFileNames, " or ")+" of the package directory or the module root)")
+	fs.BoolVar(&opts.failFast, "fail-fast", false, "stop at the first package that fails to generate")
+}
+
+// setFlags returns the names of the flags set explicitly
+func setFlags(fs *flag.FlagSet) map[string]bool {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
+
+// validateOptions returns an error if the options are invalid or
+// conflict with each other
+func validateOptions(opts *options) error {
+	if !token.IsIdentifier(opts.varName) {
+		return fmt.Errorf("-var %q is not a valid Go identifier", opts.varName)
+	}
+
+	if _, ok := generators[opts.format]; !ok {
+		return fmt.Errorf("unknown -format %q", opts.format)
+	}
+
+	if !isDialect(opts.dialect) {
+		return fmt.Errorf("-dialect %q must be one of postgres, mysql, sqlite or none", opts.dialect)
+	}
+
+	if opts.sort != sortAlpha && opts.sort != sortSource {
+		return fmt.Errorf("-sort %q must be either alpha or source", opts.sort)
+	}
+
+	for _, receiver := range opts.receivers {
+		slash := strings.LastIndex(receiver, "/")
+		dot := strings.LastIndex(receiver, ".")
+		if dot <= slash+1 || !token.IsIdentifier(receiver[dot+1:]) {
+			return fmt.Errorf("-receiver %q must be of the form import/path.Name", receiver)
+		}
+	}
+
+	if opts.allPlatforms && opts.goos != "" {
+		return errors.New("-all-platforms and -goos are mutually exclusive")
+	}
+
+	if opts.allBuildConfigs && opts.allPlatforms {
+		return errors.New("-all-build-configs and -all-platforms are mutually exclusive")
+	}
+
+	if _, err := denyList(opts.deny); err != nil {
+		return fmt.Errorf("-deny: %v", err)
+	}
+
+	opts.excludeRegexps = nil
+	for _, pattern := range opts.excludeQueries {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("-exclude-query %q: %v", pattern, err)
+		}
+		opts.excludeRegexps = append(opts.excludeRegexps, re)
+	}
+
+	switch opts.mod {
+	case "", "readonly", "vendor", "mod":
+	default:
+		return fmt.Errorf("-mod %q must be one of readonly, vendor or mod", opts.mod)
+	}
+
+	// the flags generating or changing the Go code only
+	for _, goFlag := range []struct {
+		name string
+		set  bool
+	}{
+		{"append", opts.appendManual},
+		{"extract-sprintf", opts.extractSprintf},
+		{"prepare-all", opts.prepareAll},
+		{"sqlx", opts.sqlx},
+		{"struct", opts.statementsStruct},
+		{"export", opts.setFlags["export"]},
+		{"inventory", opts.inventory},
+		{"also-sql", opts.alsoSQL},
+		{"statement-names", opts.statementIDs},
+		{"pgx", opts.pgx},
+		{"raw-strings", opts.rawStrings},
+		{"build-tag", opts.buildTag != ""},
+		{"template", opts.templateFile != ""},
+	} {
+		if goFlag.set && !isGoFormat(opts.format) {
+			return fmt.Errorf("-%s can't be combined with -format %s", goFlag.name, opts.format)
+		}
+	}
+
+	if opts.appendInit {
+		if opts.format != formatSlice {
+			return fmt.Errorf("-append-init can't be combined with -format %s", opts.format)
+		}
+		if opts.appendManual || opts.prepareAll || opts.sqlx || opts.statementsStruct {
+			return errors.New("-append-init can't be combined with -append, -prepare-all, -sqlx or -struct")
+		}
+	}
+
+	if opts.splitByFile {
+		if opts.format != formatSlice {
+			return fmt.Errorf("-split-by-file can't be combined with -format %s", opts.format)
+		}
+		if opts.appendManual || opts.prepareAll || opts.sqlx || opts.statementsStruct || opts.stdout {
+			return errors.New("-split-by-file can't be combined with -append, -prepare-all, -sqlx, -struct or -stdout")
+		}
+	}
+
+	if opts.buildTag != "" {
+		if _, err := constraint.Parse("//go:build " + opts.buildTag); err != nil {
+			return fmt.Errorf("invalid -build-tag %q: %v", opts.buildTag, err)
+		}
+	} else if opts.legacyBuildTags {
+		return errors.New("-legacy-build-tags requires -build-tag")
+	}
+
+	if err := validateFileName(opts); err != nil {
+		return err
+	}
+
+	if err := validateDir(opts); err != nil {
+		return err
+	}
+
+	if countTrue(opts.check, opts.stdout, opts.dryRun, opts.report != "") > 1 {
+		return errors.New("-check, -stdout, -n and -report are mutually exclusive")
+	}
+
+	if (opts.dsn == "") != (opts.driver == "") {
+		return errors.New("-dsn and -driver must be set together")
+	}
+
+	if opts.driver != "" && !isDriver(opts.driver) {
+		return fmt.Errorf("unknown -driver %q, registered drivers: %s", opts.driver, registeredDrivers())
 	}
-	defer file.Close()
 
-	if _, err := file.Write(code); err != nil {
-		log.Fatalf("prep: failed to write generated code to the file: %v", err)
+	if opts.json && (opts.stdout || opts.dryRun || opts.report != "") {
+		return errors.New("-json can't be combined with -stdout, -n or -report")
 	}
+
+	if len(opts.sourcePackageNames) > 1 && filepath.IsAbs(opts.outputFileName) {
+		return errors.New("-o must be relative to the package directory when generating multiple packages")
+	}
+
+	for _, name := range opts.sourcePackageNames {
+		if strings.Contains(name, "...") {
+			opts.skipEmpty = true
+		}
+	}
+
+	return nil
+}
+
+// validateDir returns an error if the -dir and -pkg options can't
+// be applied to the source packages
+func validateDir(opts *options) error {
+	if opts.dir == "" {
+		if opts.pkg != "" {
+			return errors.New("-pkg requires -dir")
+		}
+		return nil
+	}
+
+	if len(opts.sourcePackageNames) > 1 || strings.Contains(opts.sourcePackageNames[0], "...") {
+		return errors.New("-dir requires a single source package")
+	}
+
+	if filepath.IsAbs(opts.outputFileName) {
+		return errors.New("-o must be relative to -dir")
+	}
+
+	if opts.testOutput {
+		return errors.New("-test-output can't be combined with -dir, test files can't be imported")
+	}
+
+	if opts.pkg != "" && !token.IsIdentifier(opts.pkg) {
+		return fmt.Errorf("-pkg %q is not a valid Go identifier", opts.pkg)
+	}
+
+	return nil
 }
 
-func getPathToPackage(importPath string) (string, error) {
-	p, err := build.Default.Import(importPath, "", build.FindOnly)
+// validateFileName returns an error if the -filename option is not
+// a valid base name of the generated file
+func validateFileName(opts *options) error {
+	if opts.fileName == "" {
+		return nil
+	}
+
+	if opts.outputFileName != "" {
+		return errors.New("-filename and -o are mutually exclusive")
+	}
+
+	if opts.fileName != filepath.Base(opts.fileName) || opts.fileName == "." || opts.fileName == ".." {
+		return fmt.Errorf("-filename %q must be a base name without directories", opts.fileName)
+	}
+
+	if !isGoFormat(opts.format) {
+		return nil
+	}
+
+	if !strings.HasSuffix(opts.fileName, ".go") {
+		return fmt.Errorf("-filename %q must end in .go", opts.fileName)
+	}
+
+	if strings.HasSuffix(opts.fileName, "_test.go") {
+		return fmt.Errorf("-filename %q must not end in _test.go, use -test-output instead", opts.fileName)
+	}
+
+	return nil
+}
+
+// generateAll loads the source packages and generates the code for
+// every one of them
+func generateAll(sourcePackageNames []string, opts *options) runResult {
+	groups, err := loadGroups(sourcePackageNames, opts)
 	if err != nil {
-		return "", fmt.Errorf("failed to detect absolute path of the package %q: %v", importPath, err)
+		return runResult{exitCode: fatalf("%v", err)}
+	}
+
+	if err := checkReceivers(groupTypes(groups...), opts.receivers, true); err != nil {
+		return runResult{exitCode: fatalf("%v", err)}
+	}
+
+	result := runResult{exitCode: exitOK}
+	excluded := map[string]int{}
+	for _, group := range groups {
+		if dir, err := Dir(group.pkg); err == nil {
+			result.dirs = append(result.dirs, dir)
+		}
+
+		report, err := generate(group, opts)
+		report.err = err
+		if opts.report != "" || opts.json {
+			result.reports = append(result.reports, report)
+		}
+		if report.outputPath != "" {
+			result.outputs = append(result.outputs, report.outputPath)
+		}
+		if err != nil {
+			log.Printf("prep: %s: %v", group.pkg.PkgPath, err)
+			result.exitCode = exitFailure
+			var unreachable *unreachableError
+			var dsnErr *dsnError
+			switch {
+			case errors.As(err, &unreachable):
+				result.exitCode = exitUnreachable
+			case errors.As(err, &dsnErr):
+				result.exitCode = exitUsage
+			}
+
+			if opts.failFast {
+				return result
+			}
+		}
+		result.queries += report.queries
+		for pattern, n := range report.excluded {
+			excluded[pattern] += n
+		}
+	}
+
+	// the stale patterns are noticed once the statements they excluded
+	// are gone
+	for _, pattern := range opts.excludeQueries {
+		if excluded[pattern] == 0 {
+			log.Printf("prep: warning: -exclude-query %s matches no statement", pattern)
+		}
 	}
+	return result
+}
 
-	return filepath.Clean(p.Dir), nil
+// groupTypes returns the type information of the packages of the groups
+func groupTypes(groups ...*packageGroup) []*types.Package {
+	var pkgs []*types.Package
+	for _, g := range groups {
+		for _, p := range g.all {
+			if p.Types != nil {
+				pkgs = append(pkgs, p.Types)
+			}
+		}
+	}
+	return pkgs
 }
 
-func generateCode(packageName, importPath string, queries []string) []byte {
-	buf := bytes.NewBuffer([]byte{})
+// fatalf logs the error and returns the exit code of a failed run
+func fatalf(format string, args ...interface{}) int {
+	log.Printf("prep: "+format, args...)
+	return exitFailure
+}
 
-	if len(queries) == 0 {
-		fmt.Fprintf(buf,
-			"//go:generate prep -f %s\n\npackage %s\n\nfunc init() {\n\tprepStatements = []string{}\n}",
-			importPath, packageName)
+// usageError prints the error followed by the usage of the tool to
+// the standard error and returns the exit code of a misconfigured run
+func usageError(format string, args ...interface{}) int {
+	fmt.Fprintf(flag.CommandLine.Output(), "prep: "+format+"\n", args...)
+	flag.Usage()
+	return exitUsage
+}
+
+// readPackageList returns the package import paths or patterns listed
+// in the file, blank lines and lines starting with # are ignored
+func readPackageList(fileName string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if fileName != "-" {
+		file, err := os.Open(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open package list: %v", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	var names []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
 
-		return buf.Bytes()
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read package list: %v", err)
 	}
 
-	fmt.Fprintf(buf,
-		"//go:generate prep -f %s\n\npackage %s\n\nfunc init() {\n\tprepStatements = []string{\n\t\t%s,\n\t}\n}",
-		importPath, packageName, strings.Join(queries, ",\n\t\t"))
-	return buf.Bytes()
+	return names, nil
 }
 
-// uniqueStrings returns a sorted slice of the unique strings
-// from the given strings slice
-func uniqueStrings(strings []string) []string {
-	m := make(map[string]struct{})
-	for _, s := range strings {
-		m[s] = struct{}{}
+// outputPathFor returns the path of the file generated for the
+// package located in dir
+func outputPathFor(dir string, opts *options) string {
+	if opts.dir != "" {
+		dir = opts.dir
 	}
 
-	var unique []string
-	for s := range m {
-		unique = append(unique, s)
+	outputPath := opts.outputFileName
+	if outputPath == "" {
+		outputPath = opts.fileName
+	}
+	if outputPath == "" {
+		outputPath = formatFileNames[opts.format]
+	}
+	if !filepath.IsAbs(outputPath) {
+		outputPath = filepath.Join(dir, outputPath)
+	}
+	if opts.testOutput && isGoFormat(opts.format) && !strings.HasSuffix(outputPath, "_test.go") {
+		outputPath = strings.TrimSuffix(outputPath, ".go") + "_test.go"
 	}
 
-	sort.Strings(unique)
-	return unique
+	return outputPath
 }
 
-// maps method name to the interface it implements
-var methodImplements = map[string]string{
-	"ExecContext":         "ExecContext",
-	"QueryContext":        "QueryContext",
-	"QueryRowContext":     "QueryRowContext",
-	"NamedExecContext":    "NamedExecContext",
-	"GetContext":          "GetContext",
-	"SelectContext":       "SelectContext",
-	"NamedQueryContext":   "NamedQueryContext",
-	"PrepareContext":      "PrepareContext",
-	"PrepareNamedContext": "PrepareNamedContext",
+// generate scans the package and its test variants for queries and
+// writes the generated code into the package's output file, it returns
+// the report of the matched calls and the number of the generated
+// statements, the options of the command are combined with the
+// configuration file of the package
+func generate(group *packageGroup, cmdOpts *options) (packageReport, error) {
+	sourcePackage := group.pkg
+	report := packageReport{pkgPath: sourcePackage.PkgPath}
+
+	dir, err := Dir(sourcePackage)
+	if err != nil {
+		return report, err
+	}
+
+	opts, configFile, err := configure(dir, cmdOpts)
+	if err != nil {
+		return report, err
+	}
+
+	if err := checkReceivers(groupTypes(group), opts.receivers, false); err != nil {
+		return report, err
+	}
+
+	outputPath := outputPathFor(dir, opts)
+	if inVendor(outputPath) {
+		return report, fmt.Errorf("%s: refusing to write into the vendor tree, vendored packages are regenerated by go mod vendor", outputPath)
+	}
+	report.outputPath = outputPath
+
+	finder := newQueryFinder(sourcePackage.Fset, opts.methods, opts.receivers)
+	finder.verbose = opts.verbose
+	finder.exclude = opts.exclude
+	finder.includeGenerated = opts.includeGenerated
+	finder.dynamicLookups = opts.dynamicLookups
+	finder.generatedFiles = append([]string{outputPath, pgxPath(outputPath)}, splitFiles(outputPath)...)
+	for i, p := range group.all {
+		if len(p.Errors) > 0 {
+			return report, p.Errors[0]
+		}
+
+		config := ""
+		if i < len(group.configs) {
+			config = group.configs[i]
+		}
+		finder.setConfig(config)
+
+		n := len(finder.queries)
+		if err := finder.scan(p); err != nil {
+			return report, err
+		}
+		if opts.verbose && config != "" {
+			log.Printf("prep: %s: %s: %d queries extracted", p.ID, config, len(finder.queries)-n)
+		}
+	}
+
+	sqlQueries, err := sqlDirQueries(dir, opts.sqlDirs)
+	if err != nil {
+		return report, err
+	}
+
+	queries := uniqueNames(uniqueQueries(append(finder.queries, sqlQueries...)))
+	if opts.normalize {
+		queries = rewriteQueries(queries, normalize)
+	}
+	queries = rebindQueries(queries, opts.dialect)
+	if opts.rawStrings {
+		queries = rawQueries(queries)
+	}
+	queries = sortQueries(queries, opts.sort)
+	collapsed := len(finder.queries) + len(sqlQueries) - len(queries)
+
+	var excluded []excludedQuery
+	queries, excluded = excludeQueries(queries, opts.excludeRegexps)
+	queries = uniqueKeys(queries)
+	report.excluded = map[string]int{}
+	for _, e := range excluded {
+		report.excluded[e.pattern]++
+		finder.markExcluded(e)
+		if opts.verbose {
+			log.Printf("prep: %s: %s excluded by -exclude-query %s", sourcePackage.PkgPath, e.Value, e.pattern)
+		}
+	}
+
+	unresolved := finder.unresolved()
+	if opts.verbose {
+		log.Printf("prep: %s: %d call sites seen, %d queries extracted, %d read from SQL files, %d duplicates collapsed, %d excluded, %d unresolved",
+			sourcePackage.PkgPath, len(finder.sites), len(finder.queries), len(sqlQueries), collapsed, len(excluded), len(unresolved))
+	}
+
+	report.sites = finder.sites
+	if opts.report != "" {
+		report.queries = len(queries)
+		return report, nil
+	}
+
+	if len(opts.deny) > 0 {
+		if err := checkDenied(queries, opts.deny); err != nil {
+			return report, err
+		}
+	}
+
+	if opts.validate {
+		if err := validateQueries(queries, opts.dialect); err != nil {
+			return report, err
+		}
+	}
+
+	if opts.dsn != "" {
+		if err := prepareQueries(opts.driver, opts.dsn, opts.prepareTimeout, queries); err != nil {
+			return report, err
+		}
+	}
+
+	if len(unresolved) > 0 {
+		if opts.strict {
+			logUnresolved(unresolved)
+			return report, fmt.Errorf("%d queries can't be extracted", len(unresolved))
+		}
+
+		if !opts.verbose {
+			log.Printf("prep: %s: %d queries can't be extracted, run with -v to list them", sourcePackage.PkgPath, len(unresolved))
+		}
+	}
+
+	if len(queries) == 0 && opts.skipEmpty {
+		// regenerate the file of a package that no longer has
+		// any queries to not leave stale statements behind
+		if _, err := os.Stat(outputPath); os.IsNotExist(err) {
+			return report, nil
+		}
+	}
+
+	t, err := newTarget(sourcePackage, dir, opts)
+	if err != nil {
+		return report, err
+	}
+	t.header = generatedBy(sourcePackage.PkgPath, filepath.Dir(outputPath), configFile, cmdOpts)
+	t.dialect, t.outputDir = opts.dialect, filepath.Dir(outputPath)
+	t.prepareAll, t.prepareAllx, t.statementsStruct = opts.prepareAll, opts.sqlx, opts.statementsStruct
+	if opts.extractSprintf {
+		t.templates = []string{}
+		for _, q := range uniqueQueries(finder.templates) {
+			t.templates = append(t.templates, q.Value)
+		}
+	}
+
+	written := queries
+	if opts.appendManual {
+		section, err := readManualSection(outputPath)
+		if err != nil {
+			return report, err
+		}
+
+		// the discovered statements win over the manual ones
+		t.manual, err = section.without(queries)
+		if err != nil {
+			return report, err
+		}
+		for _, entry := range t.manual.entries {
+			written = append(written, query{Value: entry.value})
+		}
+	}
+
+	if len(written) == 0 && !opts.allowEmpty {
+		logUnresolved(unresolved)
+		return report, errors.New("no queries found, use -allow-empty if the package has none")
+	}
+
+	report.checksum = statementsChecksum(written)
+	if !opts.appendInit {
+		// the files appending to the variable hold a part of its
+		// statements each, their checksums would collide
+		t.checksum = report.checksum
+	}
+	if opts.statementIDs || opts.pgx {
+		if t.statementIDs, err = newStatementIDs(written); err != nil {
+			return report, err
+		}
+	}
+
+	// the statements of the source files are written by -split-by-file
+	// into the files of their own
+	emitted, emittedWritten := queries, written
+	var groups map[string][]query
+	if opts.splitByFile {
+		groups = splitQueries(queries)
+		emitted, emittedWritten = groups[""], groups[""]
+		t.appendStatements = !t.declare
+	}
+	if opts.appendInit {
+		t.appendStatements = !t.declare
+	}
+
+	var generated []byte
+	if opts.templateFile != "" {
+		generated, err = templateCode(t, outputPath, emitted, opts)
+	} else {
+		generated, err = code(t, emitted, opts)
+	}
+	if err != nil {
+		return report, err
+	}
+
+	report.queries = len(queries)
+	report.statements = queries
+	if err := write(outputPath, generated, t.varName, emittedWritten, opts); err != nil {
+		return report, err
+	}
+	if opts.splitByFile {
+		if err := writeSplit(t, outputPath, groups, opts); err != nil {
+			return report, err
+		}
+	}
+	if opts.inventory {
+		if err := writeCompanion(companionPath(outputPath, ".json"), generateInventory(t, written), opts); err != nil {
+			return report, err
+		}
+	}
+	if opts.alsoSQL {
+		sql, err := generateSQL(t, written)
+		if err != nil {
+			return report, err
+		}
+		if err := writeCompanion(companionPath(outputPath, ".sql"), sql, opts); err != nil {
+			return report, err
+		}
+	}
+	if opts.pgx {
+		pgxTarget := t
+		if pgxTarget.header, err = fileHeader("// Generated together with "+filepath.Base(outputPath)+".", opts); err != nil {
+			return report, err
+		}
+		pgx, err := formatGo(pgxCode(pgxTarget))
+		if err != nil {
+			return report, err
+		}
+		if err := writeCompanion(pgxPath(outputPath), pgx, opts); err != nil {
+			return report, err
+		}
+	}
+
+	report.written = !opts.stdout && !opts.check && !opts.dryRun
+	if report.written && isGoFormat(opts.format) && !t.declare {
+		warnMixedInits(filepath.Dir(outputPath), t.varName)
+	}
+	return report, nil
 }
 
-// Visit implements ast.Visitor interface
-func (f *queryFinder) Visit(node ast.Node) ast.Visitor {
-	fCall, ok := node.(*ast.CallExpr)
-	if !ok {
-		return f
+// inVendor reports whether any directory of the path is a vendor tree
+func inVendor(path string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(filepath.Dir(path)), "/") {
+		if elem == "vendor" {
+			return true
+		}
 	}
+	return false
+}
 
-	selector, ok := fCall.Fun.(*ast.SelectorExpr)
-	if !ok {
-		return f
+// writeSplit writes the files of -split-by-file appending the statements
+// of the groups but the one of no source file to the variable, the
+// previously written files of the other source files are removed
+func writeSplit(t target, outputPath string, groups map[string][]query, opts *options) error {
+	bases := make([]string, 0, len(groups))
+	for base := range groups {
+		if base != "" {
+			bases = append(bases, base)
+		}
 	}
+	sort.Strings(bases)
+
+	kept := make(map[string]struct{}, len(bases))
+	for _, base := range bases {
+		path := splitPath(outputPath, base)
+		kept[path] = struct{}{}
 
-	interfaceName := methodImplements[selector.Sel.Name]
-	if interfaceName == "" {
-		return f
+		split := target{
+			packageName:       t.packageName,
+			sourcePackageName: t.sourcePackageName,
+			importPath:        t.importPath,
+			varName:           t.varName,
+			outputDir:         t.outputDir,
+			appendStatements:  true,
+		}
+		var err error
+		if split.header, err = fileHeader(splitMarker+"the "+base+" source file, generated together with "+filepath.Base(outputPath)+".", opts); err != nil {
+			return err
+		}
+
+		generated, err := generateCode(split, groups[base])
+		if err != nil {
+			return err
+		}
+		code, err := formatGo(generated)
+		if err != nil {
+			return err
+		}
+		if err := write(path, code, t.varName, groups[base], opts); err != nil {
+			return err
+		}
 	}
 
-	var query string
-	switch selector.Sel.Name {
-	case "ExecContext", "QueryContext", "QueryRowContext", "NamedExecContext", "NamedQueryContext", "PrepareContext", "PrepareNamedContext":
-		query = f.processQuery(fCall.Args[1])
-	case "GetContext", "SelectContext":
-		query = f.processQuery(fCall.Args[2])
+	for _, path := range splitFiles(outputPath) {
+		if _, ok := kept[path]; ok {
+			continue
+		}
+
+		switch {
+		case opts.check:
+			return fmt.Errorf("%s is stale, run prep to remove it", path)
+		case opts.dryRun:
+			fmt.Printf("%s: stale, removed\n", path)
+		default:
+			if err := os.Remove(path); err != nil {
+				return fmt.Errorf("failed to remove stale file: %v", err)
+			}
+		}
 	}
+	return nil
+}
 
-	if query != "" {
-		f.queries = append(f.queries, query)
+// writeCompanion writes the file generated next to the Go code, i.e. the
+// JSON inventory, or, depending on the options, checks or compares it
+// with the file, it isn't printed by -stdout
+func writeCompanion(path string, contents []byte, opts *options) error {
+	switch {
+	case opts.stdout:
+		return nil
+	case opts.check:
+		var w io.Writer = os.Stdout
+		if opts.json {
+			w = os.Stderr
+		}
+		return check(w, path, contents)
+	case opts.dryRun:
+		existing, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		if bytes.Equal(existing, contents) {
+			fmt.Printf("%s: up to date\n", path)
+			return nil
+		}
+		fmt.Print(unifiedDiff(path, path+" (generated)", existing, contents))
+		return nil
 	}
 
+	if err := writeAtomically(path, contents); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
 	return nil
 }
 
-// processQuery returns a string value of the expression if the
-// expression is either a string literal or a string constant otherwise
-// an empty string is returned
-func (f *queryFinder) processQuery(queryArg ast.Expr) string {
-	switch q := queryArg.(type) {
-	case *ast.BasicLit:
-		return q.Value
-	case *ast.Ident:
-		if _, ok := f.nonUniqueNames[q.Name]; ok {
-			log.Fatalf("constant already defined, need unique name for %v", q.Name)
+// generatedBy returns the directive reproducing the file generated into
+// outputDir preceded by the configuration file used, the paths of the
+// configuration file are relative to outputDir like go generate expects
+func generatedBy(importPath, outputDir, configFile string, cmdOpts *options) string {
+	if configFile == "" {
+		return directive(importPath, cmdOpts)
+	}
+
+	rel := configFile
+	if abs, err := filepath.Abs(configFile); err == nil {
+		if r, err := filepath.Rel(outputDir, abs); err == nil {
+			rel = filepath.ToSlash(r)
 		}
-		return f.packageInfo[q.Name]
 	}
-	return ""
+
+	directiveOpts := *cmdOpts
+	if directiveOpts.configFile != "" {
+		directiveOpts.configFile = rel
+	}
+
+	return fmt.Sprintf("// Configured by %s.\n%s", rel, directive(importPath, &directiveOpts))
 }
 
-var errPackageNotFound = errors.New("package not found")
+// logUnresolved logs the matched calls which queries can't be extracted
+func logUnresolved(sites []callSite) {
+	for _, site := range sites {
+		if site.Expr == "" {
+			log.Printf("prep: %s:%d: %s: unresolved query: %s", site.Pos.Filename, site.Pos.Line, site.Method, site.Reason)
+			continue
+		}
+		log.Printf("prep: %s:%d: %s: unresolved query %s: %s", site.Pos.Filename, site.Pos.Line, site.Method, site.Expr, site.Reason)
+	}
+}
 
-// Load loads package by its import path
-func Load(path string) (*packages.Package, error) {
-	cfg := &packages.Config{Mode: packages.LoadSyntax}
-	pkgs, err := packages.Load(cfg, path)
+// newTarget returns the description of the file generated for the
+// package located in dir, the variable is declared and exported if
+// the file belongs to another package
+func newTarget(sourcePackage *packages.Package, dir string, opts *options) (target, error) {
+	t := target{
+		packageName:       sourcePackage.Name,
+		sourcePackageName: sourcePackage.Name,
+		importPath:        sourcePackage.PkgPath,
+		varName:           opts.varName,
+		export:            opts.export,
+	}
+
+	if opts.dir == "" {
+		return t, nil
+	}
+
+	targetDir, err := filepath.Abs(opts.dir)
 	if err != nil {
+		return t, fmt.Errorf("failed to resolve -dir: %v", err)
+	}
+	if targetDir == dir {
+		return t, nil
+	}
+
+	t.packageName = opts.pkg
+	if t.packageName == "" {
+		t.packageName = filepath.Base(targetDir)
+	}
+	if !token.IsIdentifier(t.packageName) {
+		return t, fmt.Errorf("base name of -dir %q is not a valid package name, use -pkg", opts.dir)
+	}
+
+	t.declare, t.export = true, !opts.setFlags["export"] || opts.export
+	t.varName = exportedName(opts.varName)
+	return t, nil
+}
+
+// exportedName returns the name with the first letter in upper case
+func exportedName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+// code returns the contents of the file generated for the target, the
+// header of the target is prefixed with the version of the tool and the
+// custom header
+func code(t target, queries []query, opts *options) ([]byte, error) {
+	var err error
+	if t.header, err = fileHeader(t.header, opts); err != nil {
 		return nil, err
 	}
 
-	if len(pkgs) < 1 {
-		return nil, errPackageNotFound
+	generated, err := generators[opts.format](t, queries)
+	if err != nil {
+		return nil, err
+	}
+	if !isGoFormat(opts.format) {
+		return generated, nil
 	}
+	return formatGo(generated)
+}
+
+// formatGo returns the generated Go code formatted by gofmt and ending
+// with a newline, the code failing to format is dumped to a temporary
+// file as it means the statements are quoted wrong
+func formatGo(code []byte) ([]byte, error) {
+	formatted, err := format.Source(code)
+	if err != nil {
+		dump, dumpErr := os.CreateTemp("", "prep-*.go")
+		if dumpErr != nil {
+			return nil, fmt.Errorf("failed to format generated code: %v", err)
+		}
+		defer dump.Close()
 
-	if len(pkgs[0].Errors) > 0 {
-		return nil, pkgs[0].Errors[0]
+		dump.Write(code)
+		return nil, fmt.Errorf("failed to format generated code, the unformatted code is in %s: %v", dump.Name(), err)
 	}
 
-	return pkgs[0], nil
+	if !bytes.HasSuffix(formatted, []byte("\n")) {
+		formatted = append(formatted, '\n')
+	}
+	return formatted, nil
+}
+
+// fileHeader returns the header of the generated file with the
+// directive, the custom header and the build lines of the options
+func fileHeader(directive string, opts *options) (string, error) {
+	var custom []byte
+	if opts.headerFile != "" {
+		var err error
+		if custom, err = os.ReadFile(opts.headerFile); err != nil {
+			return "", fmt.Errorf("failed to read header: %v", err)
+		}
+	}
+
+	var build string
+	if opts.buildTag != "" {
+		var err error
+		if build, err = buildLines(opts.buildTag, opts.legacyBuildTags); err != nil {
+			return "", err
+		}
+	}
+	return header(commentBlock(string(custom)), build, directive), nil
+}
+
+// write writes the generated code to the output file or, depending on
+// the options, prints it, checks or compares it with the file
+func write(outputPath string, code []byte, varName string, queries []query, opts *options) error {
+	if opts.stdout {
+		if _, err := os.Stdout.Write(code); err != nil {
+			return fmt.Errorf("failed to write generated code to the standard output: %v", err)
+		}
+		return nil
+	}
+
+	if opts.check {
+		// the standard output holds the JSON document
+		var w io.Writer = os.Stdout
+		if opts.json {
+			w = os.Stderr
+		}
+		return check(w, outputPath, code)
+	}
+
+	if opts.dryRun {
+		return dryRun(outputPath, varName, queries, code)
+	}
+
+	if err := checkOutputDir(outputPath); err != nil {
+		return err
+	}
+
+	if err := writeAtomically(outputPath, code); err != nil {
+		return fmt.Errorf("failed to write generated code to the file: %v", err)
+	}
+
+	return nil
 }
 
-// AST returns package's abstract syntax tree
-func AST(fs *token.FileSet, p *packages.Package) (*ast.Package, error) {
-	dir := Dir(p)
+// writeAtomically replaces the file with the contents by renaming the
+// synced temporary file of its directory over it, so that the file is
+// never left truncated, the file already holding the contents is kept
+// as is along with its modification time
+func writeAtomically(path string, contents []byte) error {
+	if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, contents) {
+		return nil
+	}
 
-	pkgs, err := parser.ParseDir(fs, dir, nil, parser.DeclarationErrors)
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer os.Remove(file.Name())
 
-	if ap, ok := pkgs[p.Name]; ok {
-		return ap, nil
+	if _, err := file.Write(contents); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(file.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// check compares the generated code with the contents of the output
+// file and prints the unified diff of the differences to w
+func check(w io.Writer, outputPath string, code []byte) error {
+	existing, err := os.ReadFile(outputPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s does not exist, run prep to generate it", outputPath)
+		}
+		return fmt.Errorf("failed to read the generated file: %v", err)
 	}
 
-	return &ast.Package{Name: p.Name}, nil
+	if bytes.Equal(existing, code) {
+		return nil
+	}
+
+	fmt.Fprint(w, unifiedDiff(outputPath, outputPath+" (generated)", existing, code))
+	if first, _, _ := strings.Cut(string(code), "\n"); generatedComment.MatchString(first) && !bytes.Contains(existing, []byte("// Code generated by prep ")) {
+		fmt.Fprintf(w, "note: %s was generated by an earlier version of prep, the standard Code generated header was added since\n", outputPath)
+	}
+	return fmt.Errorf("%s is out of date, run prep to regenerate it", outputPath)
 }
 
-// Dir returns absolute path of the package in a filesystem
-func Dir(p *packages.Package) string {
-	files := append(p.GoFiles, p.OtherFiles...)
-	if len(files) < 1 {
-		return p.PkgPath
+// dryRun prints the queries that would be added to or removed from
+// the output file followed by the unified diff of the file
+func dryRun(outputPath, varName string, queries []query, code []byte) error {
+	existing, err := os.ReadFile(outputPath)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read the generated file: %v", err)
+	}
+
+	if bytes.Equal(existing, code) {
+		fmt.Printf("%s: up to date\n", outputPath)
+		return nil
+	}
+
+	values := make([]string, 0, len(queries))
+	for _, q := range queries {
+		values = append(values, q.Value)
+	}
+
+	current := existingQueries(existing, varName)
+	fmt.Printf("%s:\n", outputPath)
+	for _, q := range difference(values, current) {
+		fmt.Printf("+ %s\n", q)
+	}
+	for _, q := range difference(current, values) {
+		fmt.Printf("- %s\n", q)
+	}
+
+	fmt.Print(unifiedDiff(outputPath, outputPath+" (generated)", existing, code))
+	return nil
+}
+
+// existingQueries returns the statements assigned to the variable by
+// the previously generated code
+func existingQueries(code []byte, varName string) []string {
+	if len(code) == 0 {
+		return nil
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), "", code, 0)
+	if err != nil {
+		return nil
 	}
 
-	return filepath.Dir(files[0])
+	var queries []string
+	ast.Inspect(file, func(node ast.Node) bool {
+		var lhs, rhs []ast.Expr
+		switch n := node.(type) {
+		case *ast.AssignStmt:
+			lhs, rhs = n.Lhs, n.Rhs
+		case *ast.ValueSpec:
+			for _, name := range n.Names {
+				lhs = append(lhs, name)
+			}
+			rhs = n.Values
+		default:
+			return true
+		}
+
+		if len(lhs) != 1 || len(rhs) != 1 {
+			return true
+		}
+
+		if ident, ok := lhs[0].(*ast.Ident); !ok || ident.Name != varName {
+			return true
+		}
+
+		var elts []ast.Expr
+		switch v := rhs[0].(type) {
+		case *ast.CompositeLit:
+			elts = v.Elts
+		case *ast.CallExpr:
+			if isAppendTo(v, varName) {
+				elts = v.Args[1:]
+			}
+		}
+		for _, elt := range elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elt = kv.Value
+			}
+			if q, ok := elt.(*ast.BasicLit); ok {
+				queries = append(queries, q.Value)
+			}
+		}
+		return false
+	})
+
+	return queries
+}
+
+// isAppendTo reports whether the call appends to the variable
+func isAppendTo(call *ast.CallExpr, varName string) bool {
+	fun, ok := call.Fun.(*ast.Ident)
+	if !ok || fun.Name != "append" || len(call.Args) == 0 {
+		return false
+	}
+	arg, ok := call.Args[0].(*ast.Ident)
+	return ok && arg.Name == varName
+}
+
+// warnMixedInits warns if the files generated by the tool into the
+// directory both assign the variable and append to it, the appended
+// statements are lost if the assigning init runs later
+func warnMixedInits(dir, varName string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+
+	var assigning, appending []string
+	for _, path := range matches {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if first, _, _ := strings.Cut(string(code), "\n"); !generatedComment.MatchString(first) {
+			continue
+		}
+
+		file, err := parser.ParseFile(token.NewFileSet(), path, code, 0)
+		if err != nil {
+			continue
+		}
+		ast.Inspect(file, func(node ast.Node) bool {
+			assign, ok := node.(*ast.AssignStmt)
+			if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+				return true
+			}
+			if ident, ok := assign.Lhs[0].(*ast.Ident); !ok || ident.Name != varName {
+				return true
+			}
+
+			if call, ok := assign.Rhs[0].(*ast.CallExpr); ok && isAppendTo(call, varName) {
+				appending = append(appending, filepath.Base(path))
+			} else {
+				assigning = append(assigning, filepath.Base(path))
+			}
+			return false
+		})
+	}
+
+	if len(assigning) > 0 && len(appending) > 0 {
+		log.Printf("prep: %s: warning: %s assigns %s while %s appends to it, the appended statements are lost if they are appended first, use -append-init for all of them",
+			dir, strings.Join(assigning, ", "), varName, strings.Join(appending, ", "))
+	}
+}
+
+// difference returns the strings of a that are not in b
+func difference(a, b []string) []string {
+	m := make(map[string]struct{}, len(b))
+	for _, s := range b {
+		m[s] = struct{}{}
+	}
+
+	var diff []string
+	for _, s := range a {
+		if _, ok := m[s]; !ok {
+			diff = append(diff, s)
+		}
+	}
+	return diff
+}
+
+// countTrue returns the number of the true values
+func countTrue(values ...bool) int {
+	n := 0
+	for _, v := range values {
+		if v {
+			n++
+		}
+	}
+	return n
+}
+
+// checkOutputDir returns an error if the directory the output file
+// is going to be written to doesn't exist
+func checkOutputDir(outputPath string) error {
+	dir := filepath.Dir(outputPath)
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("output directory %q does not exist", dir)
+		}
+		return fmt.Errorf("failed to check output directory %q: %v", dir, err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("output directory %q is not a directory", dir)
+	}
+
+	return nil
 }
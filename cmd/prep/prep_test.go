@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the fixtures")
+
+// parseOptions returns the options of the arguments, the flags of the
+// go:generate directive only
+func parseOptions(t *testing.T, args ...string) *options {
+	t.Helper()
+
+	opts := &options{prepareTimeout: defaultPrepareTimeout}
+	fs := flag.NewFlagSet("prep", flag.ContinueOnError)
+	registerFlags(fs, opts)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	opts.setFlags = setFlags(fs)
+	return opts
+}
+
+// fixture copies the module of testdata/name and the fake modules its
+// dependencies are replaced with to a temporary directory, changes to
+// the copy of the module and returns the directory of the fixture
+func fixture(t *testing.T, name string) string {
+	t.Helper()
+
+	testdata, err := filepath.Abs("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root := t.TempDir()
+	copyDir(t, filepath.Join(testdata, "fakes"), filepath.Join(root, "fakes"))
+	copyDir(t, filepath.Join(testdata, name), filepath.Join(root, name))
+
+	t.Chdir(filepath.Join(root, name))
+	t.Setenv("GOFLAGS", "-mod=mod")
+	t.Setenv("GOWORK", "off")
+	return filepath.Join(testdata, name)
+}
+
+// copyDir copies the files of the directory tree
+func copyDir(t *testing.T, src, dst string) {
+	t.Helper()
+
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, rel), 0o755)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, rel), data, 0o644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// runFixture generates the code of the fixture module the test changed
+// to with the flags of the go:generate directive
+func runFixture(t *testing.T, args ...string) runResult {
+	t.Helper()
+
+	opts := parseOptions(t, args...)
+	if err := validateOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	return generateAll(opts.sourcePackageNames, opts)
+}
+
+// checkGolden compares the files generated into the copy of the fixture
+// with their golden files, the .golden files of the fixture directory,
+// -update writes them instead
+func checkGolden(t *testing.T, dir string, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		golden := filepath.Join(dir, name+".golden")
+		if *update {
+			if err := os.WriteFile(golden, got, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s differs from %s:\n%s", name, golden, got)
+		}
+	}
+}
+
+func TestVendor(t *testing.T) {
+	dir := fixture(t, "vendored")
+	// the dependencies are loaded from the vendor tree only
+	if err := os.RemoveAll(filepath.Join("..", "fakes")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOFLAGS", "-mod=vendor")
+
+	if result := runFixture(t, "-f", "."); result.exitCode != exitOK {
+		t.Fatalf("exit code %d", result.exitCode)
+	}
+	checkGolden(t, dir, "prepared_statements.go")
+
+	vendored := filepath.Join("vendor", "github.com", "jmoiron", "sqlx", defaultOutputFileName)
+	if result := runFixture(t, "-f", "github.com/jmoiron/sqlx"); result.exitCode != exitFailure {
+		t.Errorf("got exit code %d generating into the vendor tree, want %d", result.exitCode, exitFailure)
+	}
+	if _, err := os.Stat(vendored); !os.IsNotExist(err) {
+		t.Errorf("%s is written: %v", vendored, err)
+	}
+}
+
+func TestWriteAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "prepared_statements.go")
+	// the temporary file is created in the directory of the file
+	t.Setenv("TMPDIR", filepath.Join(dir, "missing"))
+
+	temps := func() []string {
+		t.Helper()
+		names, err := filepath.Glob(filepath.Join(dir, ".*.tmp-*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return names
+	}
+
+	t.Run("create", func(t *testing.T) {
+		if err := writeAtomically(path, []byte("a")); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o644 {
+			t.Errorf("got mode %v, want 0644", info.Mode().Perm())
+		}
+		if names := temps(); len(names) > 0 {
+			t.Errorf("temporary files are left: %v", names)
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		// the rename replaces the directory entry, the link keeps the
+		// file of the previous contents
+		link := filepath.Join(dir, "link.go")
+		if err := os.Link(path, link); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeAtomically(path, []byte("b")); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != "b" {
+			t.Errorf("got %q, want b", data)
+		}
+		if data, _ := os.ReadFile(link); string(data) != "a" {
+			t.Errorf("the file is written in place, the link holds %q", data)
+		}
+		if names := temps(); len(names) > 0 {
+			t.Errorf("temporary files are left: %v", names)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour).Truncate(time.Second)
+		if err := os.Chtimes(path, past, past); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeAtomically(path, []byte("b")); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(past) {
+			t.Errorf("the modification time changed to %v", info.ModTime())
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		// the rename fails over the directory
+		target := filepath.Join(dir, "target")
+		if err := os.MkdirAll(filepath.Join(target, "sub"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeAtomically(target, []byte("c")); err == nil {
+			t.Fatal("writeAtomically replaces the directory")
+		}
+		if names := temps(); len(names) > 0 {
+			t.Errorf("temporary files are left: %v", names)
+		}
+	})
+}
+
+func TestSplitByFile(t *testing.T) {
+	dir := fixture(t, "split")
+	if result := runFixture(t, "-f", ".", "-goos", "windows", "-split-by-file"); result.exitCode != exitOK {
+		t.Fatalf("exit code %d", result.exitCode)
+	}
+	checkGolden(t, dir, "prepared_statements.go", "prepared_statements_accounts.go", "prepared_statements_store.go")
+
+	// the platform suffixes are stripped, the stale generated file is
+	// removed and the file written by hand is kept
+	for name, exists := range map[string]bool{
+		"prepared_statements_store_windows.go": false,
+		"prepared_statements_windows_amd64.go": false,
+		"prepared_statements_orders.go":        false,
+		"prepared_statements_notes.go":         true,
+	} {
+		if _, err := os.Stat(name); (err == nil) != exists {
+			t.Errorf("%s: got exists %t, want %t: %v", name, err == nil, exists, err)
+		}
+	}
+
+	t.Setenv("GOOS", "windows")
+	if out, err := exec.Command("go", "vet", "./...").CombinedOutput(); err != nil {
+		t.Errorf("go vet failed: %v\n%s", err, out)
+	}
+}
+
+func TestValidateOptionsGoFlags(t *testing.T) {
+	for _, args := range [][]string{
+		{"-append"}, {"-extract-sprintf"}, {"-prepare-all"}, {"-sqlx"}, {"-struct"},
+		{"-export=false"}, {"-inventory"}, {"-also-sql"}, {"-statement-names"}, {"-pgx"},
+		{"-raw-strings"}, {"-build-tag", "linux"}, {"-template", "custom.tmpl"},
+	} {
+		opts := parseOptions(t, append([]string{"-f", "./store", "-format", formatMap}, args...)...)
+		if err := validateOptions(opts); err != nil {
+			t.Errorf("%s -format map: unexpected error %v", args[0], err)
+		}
+
+		opts = parseOptions(t, append([]string{"-f", "./store", "-format", formatJSON}, args...)...)
+		name, _, _ := strings.Cut(args[0], "=")
+		want := name + " can't be combined with -format json"
+		if err := validateOptions(opts); err == nil || err.Error() != want {
+			t.Errorf("%s -format json: got error %v, want %s", args[0], err, want)
+		}
+	}
+}
+
+func TestExcludeQuery(t *testing.T) {
+	dir := fixture(t, "exclude")
+	logs := &bytes.Buffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	// the patterns match the normalized statements
+	args := []string{"-f", ".", "-exclude-query", "^CREATE TEMP TABLE", "-exclude-query", "^DELETE FROM sessions$", "-exclude-query", "^DROP"}
+	if result := runFixture(t, append(args, "-v")...); result.exitCode != exitOK {
+		t.Fatalf("exit code %d", result.exitCode)
+	}
+	checkGolden(t, dir, "prepared_statements.go")
+
+	for _, line := range []string{
+		`example.com/fixture: "CREATE TEMP TABLE scratch (id int)" excluded by -exclude-query ^CREATE TEMP TABLE`,
+		"excluded by -exclude-query ^DELETE FROM sessions$",
+		"prep: warning: -exclude-query ^DROP matches no statement",
+	} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("the log misses %s:\n%s", line, logs)
+		}
+	}
+	if strings.Contains(logs.String(), "-exclude-query ^CREATE TEMP TABLE matches no statement") {
+		t.Errorf("the matching pattern is reported stale:\n%s", logs)
+	}
+
+	opts := parseOptions(t, args...)
+	opts.report = reportText
+	if err := validateOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	result := generateAll(opts.sourcePackageNames, opts)
+	if result.exitCode != exitOK {
+		t.Fatalf("exit code %d", result.exitCode)
+	}
+	report := &bytes.Buffer{}
+	if err := writeReport(report, reportText, result.reports); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"3 call sites, 1 extracted, 0 dynamic, 0 odd, 0 ignored, 2 excluded",
+		`store.go:13: Exec: "CREATE TEMP TABLE scratch (id int)" (matches -exclude-query ^CREATE TEMP TABLE)`,
+		"sessions` (matches -exclude-query ^DELETE FROM sessions$)",
+	} {
+		if !strings.Contains(report.String(), line) {
+			t.Errorf("the report misses %s:\n%s", line, report)
+		}
+	}
+}
+
+func TestValidateOptionsExcludeQuery(t *testing.T) {
+	opts := parseOptions(t, "-f", "./store", "-exclude-query", "^SELECT", "-exclude-query", "a,b")
+	if err := validateOptions(opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.excludeRegexps) != 2 || opts.excludeRegexps[1].String() != "a,b" {
+		t.Errorf("got patterns %v, want ^SELECT and a,b", opts.excludeRegexps)
+	}
+
+	opts = parseOptions(t, "-f", "./store", "-exclude-query", "(")
+	if err := validateOptions(opts); err == nil || !strings.HasPrefix(err.Error(), `-exclude-query "(": `) {
+		t.Errorf("got error %v, want the pattern failing to compile", err)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// defaultPrepareTimeout is the default time a statement may take to
+// be prepared by -dsn
+const defaultPrepareTimeout = 5 * time.Second
+
+type (
+	// unreachableError is the failure to connect to the database the
+	// statements are prepared against
+	unreachableError struct {
+		err error
+	}
+
+	// dsnError is the failure of -driver to open the data source name
+	// of -dsn, the run is misconfigured
+	dsnError struct {
+		err error
+	}
+
+	// statementPreparer prepares the statements, it's either the
+	// connection or a transaction of it
+	statementPreparer interface {
+		PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	}
+
+	// scratchTx is the transaction the statements are prepared within,
+	// the connection is used if the driver can't begin one
+	scratchTx struct {
+		conn *sql.Conn
+		tx   *sql.Tx
+		noTx bool
+	}
+)
+
+// Error implements error interface
+func (e *unreachableError) Error() string {
+	return fmt.Sprintf("couldn't reach the database: %v", e.err)
+}
+
+// Error implements error interface
+func (e *dsnError) Error() string {
+	return fmt.Sprintf("invalid -dsn: %v", e.err)
+}
+
+// isDriver reports whether the database/sql driver is registered
+func isDriver(name string) bool {
+	for _, driver := range sql.Drivers() {
+		if driver == name {
+			return true
+		}
+	}
+	return false
+}
+
+// registeredDrivers returns the names of the registered database/sql
+// drivers separated by commas, none if there are none
+func registeredDrivers() string {
+	if drivers := sql.Drivers(); len(drivers) > 0 {
+		return strings.Join(drivers, ", ")
+	}
+	return "none"
+}
+
+// prepareQueries prepares every query against the database within a
+// transaction that is rolled back, the prepared statements are
+// deallocated right away, every query that fails is logged with the
+// calls it is found at and the server error
+func prepareQueries(driver, dsn string, timeout time.Duration, queries []query) error {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return &dsnError{err}
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return &unreachableError{err}
+	}
+	defer conn.Close()
+
+	if err := conn.PingContext(ctx); err != nil {
+		return &unreachableError{err}
+	}
+
+	tx := &scratchTx{conn: conn}
+	defer tx.rollback()
+
+	n := 0
+	for _, q := range queries {
+		if err := prepare(tx.preparer(), timeout, unquote(q.Value)); err != nil {
+			// a failed statement aborts the transaction of some
+			// databases, the next statement begins a new one
+			tx.rollback()
+
+			n++
+			if len(q.Pos) == 0 {
+				log.Printf("prep: failed to prepare %s: %v", q.Value, err)
+			}
+			for _, pos := range q.Pos {
+				log.Printf("prep: %s:%d: failed to prepare %s: %v", pos.Filename, pos.Line, q.Value, err)
+			}
+		}
+	}
+
+	if n > 0 {
+		return fmt.Errorf("%d queries failed to prepare", n)
+	}
+	return nil
+}
+
+// preparer returns the transaction the next statement is prepared
+// within, it's begun if there is none, the connection is returned if
+// the driver fails to begin it
+func (t *scratchTx) preparer() statementPreparer {
+	if t.tx == nil && !t.noTx {
+		// the transaction outlives the timeout of a single statement
+		tx, err := t.conn.BeginTx(context.Background(), nil)
+		if err != nil {
+			t.noTx = true
+			return t.conn
+		}
+		t.tx = tx
+	}
+
+	if t.tx == nil {
+		return t.conn
+	}
+	return t.tx
+}
+
+// rollback rolls back the transaction if there is one
+func (t *scratchTx) rollback() {
+	if t.tx != nil {
+		t.tx.Rollback()
+		t.tx = nil
+	}
+}
+
+// prepare prepares the statement and closes it, which deallocates it
+func prepare(p statementPreparer, timeout time.Duration, statement string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	stmt, err := p.PrepareContext(ctx, statement)
+	if err != nil {
+		return err
+	}
+	return stmt.Close()
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"go/token"
+	"log"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type (
+	// fakeDriver is the driver of the tests, the statements containing
+	// FAIL fail to prepare and abort the transaction
+	fakeDriver struct {
+		events *[]string
+	}
+
+	fakeConnector struct {
+		driver fakeDriver
+		noTx   bool
+	}
+
+	fakeConn struct {
+		connector *fakeConnector
+		inTx      bool
+		aborted   bool
+	}
+
+	fakeTx struct {
+		conn *fakeConn
+	}
+
+	fakeStmt struct {
+		conn  *fakeConn
+		query string
+	}
+)
+
+var fakeEvents []string
+
+func init() {
+	sql.Register("preptest", fakeDriver{events: &fakeEvents})
+}
+
+func (d fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("use OpenConnector")
+}
+
+func (d fakeDriver) OpenConnector(dsn string) (driver.Connector, error) {
+	switch dsn {
+	case "tx":
+		return &fakeConnector{driver: d}, nil
+	case "notx":
+		return &fakeConnector{driver: d, noTx: true}, nil
+	}
+	return nil, errors.New("unknown data source name")
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{connector: c}, nil
+}
+
+func (c *fakeConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (c *fakeConn) event(e string) {
+	*c.connector.driver.events = append(*c.connector.driver.events, e)
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	if c.aborted {
+		return nil, errors.New("current transaction is aborted")
+	}
+	c.event("prepare " + query)
+	if strings.Contains(query, "FAIL") {
+		c.aborted = c.inTx
+		return nil, errors.New("syntax error")
+	}
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	if c.connector.noTx {
+		return nil, errors.New("transactions are not supported")
+	}
+	c.event("begin")
+	c.inTx = true
+	return &fakeTx{conn: c}, nil
+}
+
+func (tx *fakeTx) Commit() error {
+	return errors.New("unexpected commit")
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.conn.event("rollback")
+	tx.conn.inTx, tx.conn.aborted = false, false
+	return nil
+}
+
+func (s *fakeStmt) Close() error {
+	s.conn.event("close " + s.query)
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("unexpected exec")
+}
+
+func (s *fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+func TestPrepareQueries(t *testing.T) {
+	queries := []query{
+		{Value: strconv.Quote("A")},
+		{Value: strconv.Quote("FAIL 1"), Pos: []token.Position{{Filename: "store.go", Line: 7}}},
+		{Value: strconv.Quote("B")},
+		{Value: strconv.Quote("FAIL 2")},
+	}
+
+	tests := []struct {
+		dsn    string
+		events []string
+	}{
+		{
+			dsn: "tx",
+			events: []string{
+				"begin", "prepare A", "close A", "prepare FAIL 1", "rollback",
+				"begin", "prepare B", "close B", "prepare FAIL 2", "rollback",
+			},
+		},
+		{
+			dsn:    "notx",
+			events: []string{"prepare A", "close A", "prepare FAIL 1", "prepare B", "close B", "prepare FAIL 2"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dsn, func(t *testing.T) {
+			fakeEvents = nil
+			logs := &bytes.Buffer{}
+			log.SetOutput(logs)
+			defer log.SetOutput(os.Stderr)
+
+			err := prepareQueries("preptest", test.dsn, time.Second, queries)
+			if err == nil || err.Error() != "2 queries failed to prepare" {
+				t.Errorf("got error %v, want 2 queries failed to prepare", err)
+			}
+			if !reflect.DeepEqual(fakeEvents, test.events) {
+				t.Errorf("got events %q, want %q", fakeEvents, test.events)
+			}
+			for _, line := range []string{`prep: store.go:7: failed to prepare "FAIL 1": syntax error`, `prep: failed to prepare "FAIL 2": syntax error`} {
+				if !strings.Contains(logs.String(), line) {
+					t.Errorf("the log misses %s:\n%s", line, logs)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareQueriesDSN(t *testing.T) {
+	for driver, dsn := range map[string]string{"preptest": "nowhere", "mysql": "root@nowhere/db"} {
+		err := prepareQueries(driver, dsn, time.Second, nil)
+		var dsnErr *dsnError
+		if !errors.As(err, &dsnErr) {
+			t.Errorf("-driver %s -dsn %s: got error %v, want a dsnError", driver, dsn, err)
+		}
+	}
+}
+
+func TestValidateOptionsDriver(t *testing.T) {
+	for driver, err := range map[string]string{
+		"postgres": "",
+		"mysql":    "",
+		"sqlite3":  `unknown -driver "sqlite3"`,
+	} {
+		opts := parseOptions(t, "-f", "./store")
+		opts.driver, opts.dsn = driver, "tx"
+		got := validateOptions(opts)
+		switch {
+		case err == "" && got != nil:
+			t.Errorf("-driver %s: unexpected error %v", driver, got)
+		case err != "" && (got == nil || !strings.HasPrefix(got.Error(), err)):
+			t.Errorf("-driver %s: got error %v, want %s", driver, got, err)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// names of the functions preparing the statements and of the types of
+// their results generated by -prepare-all, -sqlx, -struct and -pgx
+const (
+	prepareAllFuncName   = "prepareAll"
+	prepareAllxFuncName  = "prepareAllx"
+	preparedxTypeName    = "preparedx"
+	prepareErrorTypeName = "prepareError"
+	statementsTypeName   = "statements"
+	newStatementsName    = "newStatements"
+	prepareOnConnectName = "prepareOnConnect"
+)
+
+// pgxImportPath is the import path of pgx the hook generated by -pgx
+// imports
+const pgxImportPath = "github.com/jackc/pgx/v5"
+
+// pgxSQLPrefix is the length of the prefix of the statement the error
+// of the hook generated by -pgx gives
+const pgxSQLPrefix = 40
+
+type (
+	// preparedSet holds the keys of the statements prepared by the
+	// generated functions
+	preparedSet struct {
+		// keys are the keys of the statements of the slice in its
+		// order, nil for the map which is keyed already
+		keys []string
+		// named holds the keys of the statements with the named
+		// parameters of sqlx
+		named []string
+		// fields are the fields of the statements struct sorted by
+		// their names
+		fields []statementField
+	}
+
+	// statementField is the field of the statements struct holding the
+	// statement of the constant
+	statementField struct {
+		name, key string
+		// query is the expression of the statement, the element of
+		// the variable
+		query string
+	}
+)
+
+// newPreparedSet returns the keys of the queries followed by the keys of
+// the manual entries of the target, the keys of the slice are listed
+// only if it isn't keyed
+func newPreparedSet(t target, queries []query, keyed bool) preparedSet {
+	var set preparedSet
+	add := func(key, value string) {
+		if !keyed {
+			set.keys = append(set.keys, key)
+		}
+		if hasNamedParams(unquote(value)) {
+			set.named = append(set.named, key)
+		}
+	}
+
+	for i, q := range queries {
+		add(queryKey(q), q.Value)
+		if q.Name == "" {
+			continue
+		}
+
+		field := statementField{name: fieldName(q.Name), key: q.Name, query: fmt.Sprintf("%s[%d]", t.varName, i)}
+		if keyed {
+			field.query = fmt.Sprintf("%s[%q]", t.varName, q.Name)
+		}
+		set.fields = append(set.fields, field)
+	}
+	set.fields = uniqueFields(set.fields)
+	for i, entry := range t.manual.entries {
+		key := entry.key
+		switch {
+		case key == "" && entry.value != "":
+			key = queryKey(query{Value: entry.value})
+		case key == "":
+			key = fmt.Sprintf("manual_%d", i)
+		}
+		add(key, entry.value)
+	}
+	return set
+}
+
+// prepareImports returns the groups of the import paths of the
+// functions preparing the statements, nil if none is generated
+func prepareImports(t target) [][]string {
+	if !t.prepares() {
+		return nil
+	}
+
+	imports := [][]string{{"context"}}
+	if t.prepareAll || t.statementsStruct {
+		imports[0] = append(imports[0], "database/sql")
+	}
+	if t.prepareAllx {
+		imports = append(imports, []string{"github.com/jmoiron/sqlx"})
+	}
+	return imports
+}
+
+// prepares reports whether any function preparing the statements is
+// generated for the target
+func (t target) prepares() bool {
+	return t.prepareAll || t.prepareAllx || t.statementsStruct
+}
+
+// prepareCode returns the functions preparing the statements of the
+// variable enabled by the target followed by the error type of the
+// statement failing to prepare
+func prepareCode(t target, set preparedSet) string {
+	if !t.prepares() {
+		return ""
+	}
+
+	buf := bytes.NewBuffer([]byte{})
+	if t.prepareAll {
+		buf.WriteString(prepareAllCode(t, set))
+	}
+	if t.prepareAllx {
+		buf.WriteString(prepareAllxCode(t, set))
+	}
+	if t.statementsStruct {
+		buf.WriteString(statementsCode(t, set))
+	}
+
+	errName := t.generatedName(prepareErrorTypeName)
+	fmt.Fprintf(buf, "\n\n// %s is the error of the statement failing to prepare.\n", errName)
+	fmt.Fprintf(buf, "type %s struct {\n\tKey   string\n\tQuery string\n\tErr   error\n}\n\n", errName)
+	fmt.Fprintf(buf, "func (e *%s) Error() string {\n"+
+		"\treturn \"failed to prepare \" + e.Key + \" \" + e.Query + \": \" + e.Err.Error()\n}\n\n", errName)
+	fmt.Fprintf(buf, "func (e *%s) Unwrap() error {\n\treturn e.Err\n}", errName)
+	return buf.String()
+}
+
+// prepareAllCode returns the prepareAll function preparing the
+// statements against a *sql.DB
+func prepareAllCode(t target, set preparedSet) string {
+	funcName := t.generatedName(prepareAllFuncName)
+
+	buf := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(buf, "\n\n// %s prepares the statements of %s with the context,\n"+
+		"// keyed by the names of the constants holding them, the statements\n"+
+		"// already prepared are closed if one fails.\n", funcName, t.varName)
+	fmt.Fprintf(buf, "func %s(ctx context.Context, db *sql.DB) (map[string]*sql.Stmt, error) {\n", funcName)
+	fmt.Fprintf(buf, "\tstmts := make(map[string]*sql.Stmt, len(%s))\n", t.varName)
+	buf.WriteString(loopCode(t.varName, set.keys))
+	buf.WriteString("\t\tstmt, err := db.PrepareContext(ctx, query)\n")
+	buf.WriteString("\t\tif err != nil {\n")
+	buf.WriteString("\t\t\tfor _, stmt := range stmts {\n\t\t\t\tstmt.Close()\n\t\t\t}\n")
+	fmt.Fprintf(buf, "\t\t\treturn nil, &%s{Key: key, Query: query, Err: err}\n", t.generatedName(prepareErrorTypeName))
+	buf.WriteString("\t\t}\n\t\tstmts[key] = stmt\n")
+	buf.WriteString("\t}\n\treturn stmts, nil\n}")
+	return buf.String()
+}
+
+// prepareAllxCode returns the prepareAllx function preparing the
+// statements against a *sqlx.DB, the statements with the named
+// parameters are prepared as named statements
+func prepareAllxCode(t target, set preparedSet) string {
+	funcName, typeName := t.generatedName(prepareAllxFuncName), t.generatedName(preparedxTypeName)
+
+	buf := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(buf, "\n\n// %s holds the statements prepared by %s keyed by the names\n"+
+		"// of the constants holding them.\n", typeName, funcName)
+	fmt.Fprintf(buf, "type %s struct {\n\tStmts map[string]*sqlx.Stmt\n\tNamed map[string]*sqlx.NamedStmt\n}\n\n", typeName)
+
+	fmt.Fprintf(buf, "// Close closes the prepared statements.\n")
+	fmt.Fprintf(buf, "func (p *%s) Close() {\n", typeName)
+	buf.WriteString("\tfor _, stmt := range p.Stmts {\n\t\tstmt.Close()\n\t}\n")
+	buf.WriteString("\tfor _, stmt := range p.Named {\n\t\tstmt.Close()\n\t}\n}\n\n")
+
+	fmt.Fprintf(buf, "// %s prepares the statements of %s with the context, the\n"+
+		"// statements with named parameters are prepared as named statements,\n"+
+		"// the statements already prepared are closed if one fails.\n", funcName, t.varName)
+	fmt.Fprintf(buf, "func %s(ctx context.Context, db *sqlx.DB) (*%s, error) {\n", funcName, typeName)
+
+	buf.WriteString("\tnamed := map[string]bool{")
+	if len(set.named) > 0 {
+		buf.WriteString("\n")
+		for _, key := range set.named {
+			fmt.Fprintf(buf, "\t\t%q: true,\n", key)
+		}
+		buf.WriteString("\t")
+	}
+	buf.WriteString("}\n\n")
+
+	fmt.Fprintf(buf, "\tp := &%s{Stmts: map[string]*sqlx.Stmt{}, Named: map[string]*sqlx.NamedStmt{}}\n", typeName)
+	buf.WriteString(loopCode(t.varName, set.keys))
+	buf.WriteString("\t\tvar err error\n")
+	buf.WriteString("\t\tif named[key] {\n")
+	buf.WriteString("\t\t\tvar stmt *sqlx.NamedStmt\n")
+	buf.WriteString("\t\t\tif stmt, err = db.PrepareNamedContext(ctx, query); err == nil {\n\t\t\t\tp.Named[key] = stmt\n\t\t\t}\n")
+	buf.WriteString("\t\t} else {\n")
+	buf.WriteString("\t\t\tvar stmt *sqlx.Stmt\n")
+	buf.WriteString("\t\t\tif stmt, err = db.PreparexContext(ctx, query); err == nil {\n\t\t\t\tp.Stmts[key] = stmt\n\t\t\t}\n")
+	buf.WriteString("\t\t}\n")
+	buf.WriteString("\t\tif err != nil {\n\t\t\tp.Close()\n")
+	fmt.Fprintf(buf, "\t\t\treturn nil, &%s{Key: key, Query: query, Err: err}\n", t.generatedName(prepareErrorTypeName))
+	buf.WriteString("\t\t}\n")
+	buf.WriteString("\t}\n\treturn p, nil\n}")
+	return buf.String()
+}
+
+// statementsCode returns the statements struct with a field per
+// constant holding a statement and the function preparing them
+func statementsCode(t target, set preparedSet) string {
+	typeName, funcName := t.generatedName(statementsTypeName), t.generatedName(newStatementsName)
+
+	buf := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(buf, "\n\n// %s holds the prepared statements of the constants of %s.\n", typeName, t.varName)
+	fmt.Fprintf(buf, "type %s struct {", typeName)
+	if len(set.fields) > 0 {
+		width := 0
+		for _, field := range set.fields {
+			if len(field.name) > width {
+				width = len(field.name)
+			}
+		}
+		buf.WriteString("\n")
+		for _, field := range set.fields {
+			fmt.Fprintf(buf, "\t%-*s *sql.Stmt\n", width, field.name)
+		}
+	}
+	buf.WriteString("}\n\n")
+
+	fmt.Fprintf(buf, "// %s prepares the statements of the constants with the context,\n"+
+		"// the statements already prepared are closed if one fails.\n", funcName)
+	fmt.Fprintf(buf, "func %s(ctx context.Context, db *sql.DB) (*%s, error) {\n", funcName, typeName)
+	fmt.Fprintf(buf, "\ts := &%s{}\n", typeName)
+	buf.WriteString("\tfor _, field := range []struct {\n\t\tstmt       **sql.Stmt\n\t\tkey, query string\n\t}{")
+	if len(set.fields) > 0 {
+		buf.WriteString("\n")
+		for _, field := range set.fields {
+			fmt.Fprintf(buf, "\t\t{&s.%s, %q, %s},\n", field.name, field.key, field.query)
+		}
+		buf.WriteString("\t")
+	}
+	buf.WriteString("} {\n")
+	buf.WriteString("\t\tstmt, err := db.PrepareContext(ctx, field.query)\n")
+	buf.WriteString("\t\tif err != nil {\n\t\t\ts.Close()\n")
+	fmt.Fprintf(buf, "\t\t\treturn nil, &%s{Key: field.key, Query: field.query, Err: err}\n", t.generatedName(prepareErrorTypeName))
+	buf.WriteString("\t\t}\n\t\t*field.stmt = stmt\n\t}\n\treturn s, nil\n}\n\n")
+
+	names := make([]string, 0, len(set.fields))
+	for _, field := range set.fields {
+		names = append(names, "s."+field.name)
+	}
+	buf.WriteString("// Close closes the prepared statements.\n")
+	fmt.Fprintf(buf, "func (s *%s) Close() {\n", typeName)
+	fmt.Fprintf(buf, "\tfor _, stmt := range []*sql.Stmt{%s} {\n", strings.Join(names, ", "))
+	buf.WriteString("\t\tif stmt != nil {\n\t\t\tstmt.Close()\n\t\t}\n\t}\n}")
+	return buf.String()
+}
+
+// fieldName returns the exported field name of the constant name, the
+// names of the constants of the external test packages are qualified
+func fieldName(name string) string {
+	name = exportedName(strings.ReplaceAll(name, ".", "_"))
+	if r, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(r) {
+		name = "Stmt" + name
+	}
+	return name
+}
+
+// uniqueFields returns the fields sorted by their names, the fields
+// sharing the name with a preceding one in the order of the keys are
+// suffixed by their number
+func uniqueFields(fields []statementField) []statementField {
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].name != fields[j].name {
+			return fields[i].name < fields[j].name
+		}
+		return fields[i].key < fields[j].key
+	})
+
+	taken := make(map[string]struct{}, len(fields))
+	for _, field := range fields {
+		taken[field.name] = struct{}{}
+	}
+	for i := 1; i < len(fields); i++ {
+		if fields[i].name != fields[i-1].name {
+			continue
+		}
+
+		n, base := 2, fields[i].name
+		for j := i; j < len(fields) && fields[j].name == base; j++ {
+			for ; ; n++ {
+				if _, ok := taken[fmt.Sprintf("%s%d", base, n)]; !ok {
+					break
+				}
+			}
+			fields[j].name = fmt.Sprintf("%s%d", base, n)
+			taken[fields[j].name] = struct{}{}
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].name < fields[j].name })
+	return fields
+}
+
+// loopCode returns the loop over the statements of the variable binding
+// the key and the query, the statements of the slice are listed with
+// their keys
+func loopCode(varName string, keys []string) string {
+	if keys == nil {
+		return fmt.Sprintf("\tfor key, query := range %s {\n", varName)
+	}
+
+	buf := bytes.NewBufferString("\tfor _, s := range []struct {\n\t\tkey, query string\n\t}{")
+	if len(keys) > 0 {
+		buf.WriteString("\n")
+		for i, key := range keys {
+			fmt.Fprintf(buf, "\t\t{%q, %s[%d]},\n", key, varName, i)
+		}
+		buf.WriteString("\t")
+	}
+	buf.WriteString("} {\n\t\tkey, query := s.key, s.query\n")
+	return buf.String()
+}
+
+// generatedName returns the name of the generated function or type,
+// exported with -export
+func (t target) generatedName(name string) string {
+	if t.export {
+		return exportedName(name)
+	}
+	return name
+}
+
+// pgxPath returns the path of the file of the pgx hook generated next to
+// the Go code of the output path, the hook of a test file is a test file
+func pgxPath(outputPath string) string {
+	if strings.HasSuffix(outputPath, "_test.go") {
+		return strings.TrimSuffix(outputPath, "_test.go") + "_pgx_test.go"
+	}
+	return companionPath(outputPath, "_pgx.go")
+}
+
+// pgxCode returns the file of the prepareOnConnect function preparing the
+// statements on the pgx connection by their stable names, the file is
+// kept apart so that only the packages using the hook import pgx
+func pgxCode(t target) []byte {
+	funcName, names := t.generatedName(prepareOnConnectName), statementIDsVarName(t.varName)
+
+	buf := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(buf, "%s\n\npackage %s\n\n", t.header, t.packageName)
+	fmt.Fprintf(buf, "import (\n\t\"context\"\n\t\"fmt\"\n\t\"unicode/utf8\"\n\n\t%q\n)\n\n", pgxImportPath)
+	fmt.Fprintf(buf, "// %s prepares the statements of %s on the\n"+
+		"// connection by their stable names, it suits the AfterConnect hook of\n"+
+		"// pgxpool.Config.\n", funcName, names)
+	fmt.Fprintf(buf, "func %s(ctx context.Context, conn *pgx.Conn) error {\n", funcName)
+	fmt.Fprintf(buf, "\tfor name, sql := range %s {\n", names)
+	buf.WriteString("\t\tif _, err := conn.Prepare(ctx, name, sql); err != nil {\n")
+	// the prefix ends at the start of a rune to keep the message valid
+	// UTF-8
+	fmt.Fprintf(buf, "\t\t\tprefix := sql\n\t\t\tif len(prefix) > %d {\n", pgxSQLPrefix)
+	fmt.Fprintf(buf, "\t\t\t\tn := %d\n\t\t\t\tfor n > 0 && !utf8.RuneStart(prefix[n]) {\n\t\t\t\t\tn--\n\t\t\t\t}\n", pgxSQLPrefix)
+	buf.WriteString("\t\t\t\tprefix = prefix[:n] + \"...\"\n\t\t\t}\n")
+	buf.WriteString("\t\t\treturn fmt.Errorf(\"failed to prepare %s %s: %w\", name, prefix, err)\n")
+	buf.WriteString("\t\t}\n\t}\n\treturn nil\n}\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPrepareCodeCompiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		args  []string
+		files []string
+		// funcs are the generated functions
+		funcs []string
+	}{
+		{
+			name:  "package",
+			args:  []string{"-f", ".", "-prepare-all", "-sqlx", "-struct", "-pgx"},
+			files: []string{"prepared_statements.go", "prepared_statements_pgx.go"},
+			funcs: []string{"prepareAll", "prepareAllx", "newStatements", "prepareOnConnect"},
+		},
+		{
+			name:  "package exported",
+			args:  []string{"-f", ".", "-prepare-all", "-sqlx", "-struct", "-export"},
+			files: []string{"prepared_statements.go"},
+			funcs: []string{"PrepareAll", "PrepareAllx", "NewStatements"},
+		},
+		{
+			name:  "dir",
+			args:  []string{"-f", ".", "-dir", "queries", "-prepare-all", "-sqlx", "-struct", "-pgx"},
+			files: []string{"queries/prepared_statements.go", "queries/prepared_statements_pgx.go"},
+			funcs: []string{"PrepareAll", "PrepareAllx", "NewStatements", "PrepareOnConnect"},
+		},
+		{
+			name:  "dir unexported",
+			args:  []string{"-f", ".", "-dir", "queries", "-prepare-all", "-struct", "-export=false"},
+			files: []string{"queries/prepared_statements.go"},
+			funcs: []string{"prepareAll", "newStatements"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fixture(t, "prepared")
+			if result := runFixture(t, test.args...); result.exitCode != exitOK {
+				t.Fatalf("exit code %d", result.exitCode)
+			}
+
+			var code strings.Builder
+			for _, name := range test.files {
+				data, err := os.ReadFile(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				code.Write(data)
+			}
+			for _, name := range test.funcs {
+				if !strings.Contains(code.String(), "func "+name+"(") {
+					t.Errorf("%s isn't generated:\n%s", name, code.String())
+				}
+			}
+
+			if out, err := exec.Command("go", "vet", "./...").CombinedOutput(); err != nil {
+				t.Errorf("go vet failed: %v\n%s\n%s", err, out, code.String())
+			}
+		})
+	}
+}
+
+func TestPgxHookPrefix(t *testing.T) {
+	fixture(t, "pgxhook")
+	if result := runFixture(t, "-f", ".", "-pgx"); result.exitCode != exitOK {
+		t.Fatalf("exit code %d", result.exitCode)
+	}
+
+	// the fixture tests the error of the generated hook
+	if out, err := exec.Command("go", "test", "./...").CombinedOutput(); err != nil {
+		t.Errorf("go test failed: %v\n%s", err, out)
+	}
+}
+
+func TestPrepareElements(t *testing.T) {
+	fixture(t, "elements")
+	if result := runFixture(t, "-f", ".", "-prepare-all", "-struct"); result.exitCode != exitOK {
+		t.Fatalf("exit code %d", result.exitCode)
+	}
+
+	// the fixture tests the keys of the statements failing to prepare
+	if out, err := exec.Command("go", "test", "./...").CombinedOutput(); err != nil {
+		t.Errorf("go test failed: %v\n%s", err, out)
+	}
+}
+
+func TestPrepareAllKeys(t *testing.T) {
+	// the statement without a value sorts first
+	queries := []query{
+		{Value: ""},
+		{Value: strconv.Quote("DELETE FROM users WHERE id = $1"), Name: "deleteUser"},
+		{Value: strconv.Quote("SELECT name FROM users WHERE id = $1"), Name: "selectUser"},
+		{Value: strconv.Quote("UPDATE users SET seen = now()")},
+	}
+	code, err := generateCode(target{packageName: "store", varName: defaultVarName, prepareAll: true, statementsStruct: true}, queries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), "prepared_statements.go", code, 0)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, code)
+	}
+	var statements []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok {
+			return true
+		}
+		if name, ok := assign.Lhs[0].(*ast.Ident); !ok || name.Name != defaultVarName {
+			return true
+		}
+		for _, elt := range assign.Rhs[0].(*ast.CompositeLit).Elts {
+			statements = append(statements, elt.(*ast.BasicLit).Value)
+		}
+		return false
+	})
+	if len(statements) != 3 {
+		t.Fatalf("got statements %q, want the 3 of a value:\n%s", statements, code)
+	}
+
+	// the keys of prepareAll and of the fields of newStatements pair
+	// with the statements of them
+	want := map[string]string{"deleteUser": queries[1].Value, "selectUser": queries[2].Value, queryKey(queries[3]): queries[3].Value}
+	pairs := regexp.MustCompile(`"(\w+)", `+defaultVarName+`\[(\d+)\]`).FindAllStringSubmatch(string(code), -1)
+	if len(pairs) != 5 {
+		t.Errorf("got %d keyed statements, want 3 of prepareAll and 2 of newStatements:\n%s", len(pairs), code)
+	}
+	for _, pair := range pairs {
+		i, _ := strconv.Atoi(pair[2])
+		if i >= len(statements) || statements[i] != want[pair[1]] {
+			t.Errorf("%s pairs with %s[%d], want %s", pair[1], defaultVarName, i, want[pair[1]])
+		}
+	}
+}
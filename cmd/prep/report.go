@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// report formats
+const (
+	reportText = "text"
+	reportJSON = "json"
+)
+
+type (
+	// reportFlag is a flag.Value selecting the report format, the flag
+	// given without a value selects the text format
+	reportFlag string
+
+	// jsonReport is the JSON representation of the report
+	jsonReport struct {
+		Packages []jsonPackageReport `json:"packages"`
+		siteCounts
+	}
+
+	jsonPackageReport struct {
+		Package string `json:"package"`
+		Queries int    `json:"queries"`
+		siteCounts
+		Sites []jsonCallSite `json:"sites"`
+	}
+
+	jsonCallSite struct {
+		File   string     `json:"file"`
+		Line   int        `json:"line"`
+		Column int        `json:"column"`
+		Method string     `json:"method"`
+		Status siteStatus `json:"status"`
+		Name   string     `json:"name,omitempty"`
+		Expr   string     `json:"expr,omitempty"`
+		Reason string     `json:"reason,omitempty"`
+	}
+
+	// jsonRun is the JSON document describing the run
+	jsonRun struct {
+		Packages   []jsonRunPackage `json:"packages"`
+		Queries    int              `json:"queries"`
+		Unresolved int              `json:"unresolved"`
+		ExitCode   int              `json:"exitCode"`
+	}
+
+	jsonRunPackage struct {
+		Package string `json:"package"`
+		// Output is the path of the file that was or would be written
+		Output     string         `json:"output,omitempty"`
+		Written    bool           `json:"written"`
+		Checksum   string         `json:"checksum,omitempty"`
+		Queries    []jsonQuery    `json:"queries"`
+		Unresolved []jsonCallSite `json:"unresolved"`
+		Error      string         `json:"error,omitempty"`
+	}
+
+	jsonQuery struct {
+		Query     string         `json:"query"`
+		Name      string         `json:"name,omitempty"`
+		Positions []jsonPosition `json:"positions"`
+	}
+
+	jsonPosition struct {
+		File   string `json:"file"`
+		Line   int    `json:"line"`
+		Column int    `json:"column"`
+	}
+
+	// siteCounts holds the numbers of the call sites by their status
+	siteCounts struct {
+		Extracted int `json:"extracted"`
+		Dynamic   int `json:"dynamic"`
+		Odd       int `json:"odd"`
+		Ignored   int `json:"ignored"`
+		Excluded  int `json:"excluded"`
+	}
+)
+
+// String implements flag.Value interface
+func (r *reportFlag) String() string {
+	return string(*r)
+}
+
+// Set implements flag.Value interface
+func (r *reportFlag) Set(value string) error {
+	switch value {
+	case "true":
+		*r = reportText
+	case "false":
+		*r = ""
+	case reportText, reportJSON:
+		*r = reportFlag(value)
+	default:
+		return fmt.Errorf("report format %q must be either text or json", value)
+	}
+	return nil
+}
+
+// IsBoolFlag allows the flag to be given without a value
+func (r *reportFlag) IsBoolFlag() bool {
+	return true
+}
+
+// add counts the call site
+func (c *siteCounts) add(status siteStatus) {
+	switch status {
+	case siteExtracted:
+		c.Extracted++
+	case siteDynamic:
+		c.Dynamic++
+	case siteOdd:
+		c.Odd++
+	case siteIgnored:
+		c.Ignored++
+	case siteExcluded:
+		c.Excluded++
+	}
+}
+
+// writeReport writes the report of the packages in the format
+func writeReport(w io.Writer, format string, reports []packageReport) error {
+	if format == reportJSON {
+		return writeJSONReport(w, reports)
+	}
+	return writeTextReport(w, reports)
+}
+
+// writeTextReport writes the human-readable report listing the call
+// sites of every package grouped by their status
+func writeTextReport(w io.Writer, reports []packageReport) error {
+	buf := bytes.NewBuffer([]byte{})
+
+	var total siteCounts
+	for _, report := range reports {
+		var counts siteCounts
+		for _, site := range report.sites {
+			counts.add(site.Status)
+			total.add(site.Status)
+		}
+
+		fmt.Fprintf(buf, "%s: %d call sites, %d extracted, %d dynamic, %d odd, %d ignored, %d excluded\n",
+			report.pkgPath, len(report.sites), counts.Extracted, counts.Dynamic, counts.Odd, counts.Ignored, counts.Excluded)
+
+		for _, status := range []siteStatus{siteExtracted, siteDynamic, siteOdd, siteIgnored, siteExcluded} {
+			header := false
+			for _, site := range report.sites {
+				if site.Status != status {
+					continue
+				}
+				if !header {
+					fmt.Fprintf(buf, "  %s:\n", status)
+					header = true
+				}
+				fmt.Fprintf(buf, "    %s:%d: %s: %s\n", site.Pos.Filename, site.Pos.Line, site.Method, describeSite(site))
+			}
+		}
+		buf.WriteString("\n")
+	}
+
+	fmt.Fprintf(buf, "total: %d extracted, %d dynamic, %d odd, %d ignored, %d excluded\n", total.Extracted, total.Dynamic, total.Odd, total.Ignored, total.Excluded)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// describeSite returns the description of the call site query shown
+// by the text report
+func describeSite(site callSite) string {
+	switch {
+	case site.Status == siteExtracted && site.Name != "":
+		return "constant " + site.Name
+	case site.Status == siteExtracted && site.Reason != "" && site.Expr != "":
+		return fmt.Sprintf("%s (%s)", site.Expr, site.Reason)
+	case site.Status == siteExtracted:
+		return "string literal"
+	case site.Expr == "":
+		return site.Reason
+	}
+	return fmt.Sprintf("%s (%s)", site.Expr, site.Reason)
+}
+
+// writeJSONReport writes the report of the packages as JSON
+func writeJSONReport(w io.Writer, reports []packageReport) error {
+	doc := jsonReport{Packages: []jsonPackageReport{}}
+	for _, report := range reports {
+		p := jsonPackageReport{Package: report.pkgPath, Queries: report.queries, Sites: []jsonCallSite{}}
+		for _, site := range report.sites {
+			p.add(site.Status)
+			doc.add(site.Status)
+			p.Sites = append(p.Sites, newJSONCallSite(site))
+		}
+		doc.Packages = append(doc.Packages, p)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(doc)
+}
+
+// newJSONCallSite returns the JSON representation of the call site
+func newJSONCallSite(site callSite) jsonCallSite {
+	return jsonCallSite{
+		File:   site.Pos.Filename,
+		Line:   site.Pos.Line,
+		Column: site.Pos.Column,
+		Method: site.Method,
+		Status: site.Status,
+		Name:   site.Name,
+		Expr:   site.Expr,
+		Reason: site.Reason,
+	}
+}
+
+// writeRunJSON writes the JSON document describing the run
+func writeRunJSON(w io.Writer, result runResult) error {
+	doc := jsonRun{Packages: []jsonRunPackage{}, ExitCode: result.exitCode}
+	for _, report := range result.reports {
+		p := jsonRunPackage{
+			Package:    report.pkgPath,
+			Output:     report.outputPath,
+			Written:    report.written,
+			Checksum:   report.checksum,
+			Queries:    []jsonQuery{},
+			Unresolved: []jsonCallSite{},
+		}
+		if report.err != nil {
+			p.Error = report.err.Error()
+		}
+
+		for _, q := range report.statements {
+			jq := jsonQuery{Query: unquote(q.Value), Name: q.Name, Positions: []jsonPosition{}}
+			for _, pos := range q.Pos {
+				jq.Positions = append(jq.Positions, jsonPosition{File: pos.Filename, Line: pos.Line, Column: pos.Column})
+			}
+			p.Queries = append(p.Queries, jq)
+		}
+
+		for _, site := range report.sites {
+			if !site.Status.resolved() {
+				p.Unresolved = append(p.Unresolved, newJSONCallSite(site))
+			}
+		}
+
+		doc.Queries += len(p.Queries)
+		doc.Unresolved += len(p.Unresolved)
+		doc.Packages = append(doc.Packages, p)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sqlDirQueries returns the statements of the .sql files of the
+// directories, relative directories are resolved against the package
+// directory, the files are read in the order of their names
+func sqlDirQueries(packageDir string, dirs []string) ([]query, error) {
+	var queries []query
+	for _, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(packageDir, dir)
+		}
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read -sqldir: %v", err)
+		}
+
+		var names []string
+		for _, entry := range entries {
+			if !entry.IsDir() && filepath.Ext(entry.Name()) == ".sql" {
+				names = append(names, entry.Name())
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read SQL file: %v", err)
+			}
+
+			statements, err := sqlStatements(path, string(data))
+			if err != nil {
+				return nil, err
+			}
+			queries = append(queries, statements...)
+		}
+	}
+
+	return queries, nil
+}
+
+// sqlStatements splits the SQL file into the statements separated by
+// the top level semicolons, the comments preceding the statements are
+// dropped
+func sqlStatements(path, sql string) ([]query, error) {
+	segments, err := splitSQL(sql)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var queries []query
+	// start is the offset of the first token of the statement, -1
+	// until the statement has one
+	start := -1
+	add := func(end int) {
+		if start >= 0 {
+			queries = append(queries, query{
+				Value: sqlLiteral(strings.TrimSpace(sql[start:end])),
+				Pos:   []token.Position{filePosition(path, sql, start)},
+			})
+		}
+		start = -1
+	}
+
+	for _, s := range segments {
+		switch s.kind {
+		case segmentLineComment, segmentBlockComment:
+			continue
+		case segmentQuoted:
+			if start < 0 {
+				start = s.offset
+			}
+			continue
+		}
+
+		for i := 0; i < len(s.text); i++ {
+			switch c := s.text[i]; {
+			case c == ';':
+				add(s.offset + i)
+			case start < 0 && c != ' ' && c != '\t' && c != '\n' && c != '\r':
+				start = s.offset + i
+			}
+		}
+	}
+	add(len(sql))
+
+	return queries, nil
+}
+
+// sqlLiteral returns the Go literal of the statement, the multi-line
+// statements are raw strings if possible
+func sqlLiteral(text string) string {
+	if strings.Contains(text, "\n") && !strings.ContainsAny(text, "`\r") {
+		return "`" + text + "`"
+	}
+	return strconv.Quote(text)
+}
+
+// filePosition returns the position of the byte offset of the file
+func filePosition(path, text string, offset int) token.Position {
+	before := text[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := offset - strings.LastIndex(before, "\n")
+	return token.Position{Filename: path, Offset: offset, Line: line, Column: column}
+}
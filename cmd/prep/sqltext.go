@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// kinds of the SQL text segments
+const (
+	segmentCode = iota
+	segmentQuoted
+	segmentLineComment
+	segmentBlockComment
+)
+
+type (
+	// sqlSegment is a part of the SQL text, the quoted strings,
+	// identifiers and comments are never split
+	sqlSegment struct {
+		kind int
+		text string
+		// offset is the byte offset of the segment in the text
+		offset int
+	}
+)
+
+// splitSQL splits the SQL text into the segments, the error reports
+// the unterminated segment while the segments still cover all of
+// the text
+func splitSQL(sql string) ([]sqlSegment, error) {
+	var (
+		segments []sqlSegment
+		err      error
+	)
+
+	start := 0
+	flush := func(i int) {
+		if i > start {
+			segments = append(segments, sqlSegment{segmentCode, sql[start:i], start})
+		}
+	}
+
+	for i := 0; i < len(sql); {
+		kind, end, ok := segmentCode, i+1, true
+		switch c := sql[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			kind = segmentQuoted
+			end, ok = closingQuote(sql, i)
+		case c == '$' && dollarTag(sql, i) != "":
+			tag := dollarTag(sql, i)
+			kind, end, ok = segmentQuoted, len(sql), false
+			if n := strings.Index(sql[i+len(tag):], tag); n >= 0 {
+				end, ok = i+len(tag)+n+len(tag), true
+			}
+		case strings.HasPrefix(sql[i:], "--"):
+			kind, end = segmentLineComment, len(sql)
+			if n := strings.IndexByte(sql[i:], '\n'); n >= 0 {
+				end = i + n
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			kind, end, ok = segmentBlockComment, len(sql), false
+			if n := strings.Index(sql[i+2:], "*/"); n >= 0 {
+				end, ok = i+2+n+2, true
+			}
+		}
+
+		if kind == segmentCode {
+			i = end
+			continue
+		}
+
+		if !ok && err == nil {
+			err = fmt.Errorf("offset %d: unterminated %s", i, segmentNames[kind])
+		}
+
+		flush(i)
+		segments = append(segments, sqlSegment{kind, sql[i:end], i})
+		i, start = end, end
+	}
+	flush(len(sql))
+
+	return segments, err
+}
+
+// segmentNames are the names of the segment kinds reported by the
+// errors
+var segmentNames = map[int]string{
+	segmentQuoted:       "quoted string",
+	segmentBlockComment: "block comment",
+}
+
+// dollarTag returns the tag of the Postgres dollar-quoted string, i.e.
+// $$ or $body$, starting at i or an empty string if there is none
+func dollarTag(sql string, i int) string {
+	if i > 0 && isIdentByte(sql[i-1]) {
+		return ""
+	}
+
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case sql[j] == '$':
+			return sql[i : j+1]
+		case !isIdentByte(sql[j]) || j == i+1 && isDigit(sql[j]):
+			return ""
+		}
+	}
+	return ""
+}
+
+// isIdentByte reports whether the byte may be a part of an SQL identifier
+func isIdentByte(c byte) bool {
+	return c == '_' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// closingQuote returns the index following the quoted string starting
+// at i, the doubled quotes are the escaped ones, ok is false if the
+// string is unterminated
+func closingQuote(sql string, i int) (end int, ok bool) {
+	quote := sql[i]
+	for j := i + 1; j < len(sql); j++ {
+		switch {
+		case sql[j] == '\\' && quote != '`':
+			j++
+		case sql[j] == quote && j+1 < len(sql) && sql[j+1] == quote:
+			j++
+		case sql[j] == quote:
+			return j + 1, true
+		}
+	}
+	return len(sql), false
+}
+
+// normalize collapses the runs of whitespace of the SQL text to single
+// spaces and trims it, the quoted strings and comments are kept, the
+// line comments keep ending the line
+func normalize(sql string) string {
+	var b strings.Builder
+	// sep is the separator written before the next token
+	sep := ""
+	segments, _ := splitSQL(sql)
+	for _, s := range segments {
+		if s.kind != segmentCode {
+			b.WriteString(sep)
+			b.WriteString(s.text)
+			sep = ""
+			if s.kind == segmentLineComment {
+				sep = "\n"
+			}
+			continue
+		}
+
+		for _, r := range s.text {
+			if unicode.IsSpace(r) {
+				if sep == "" {
+					sep = " "
+				}
+				continue
+			}
+			b.WriteString(sep)
+			b.WriteRune(r)
+			sep = ""
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// rewriteQueries returns the queries with the statements rewritten by
+// the function, the queries that become equal are collapsed
+func rewriteQueries(queries []query, rewrite func(string) string) []query {
+	rewritten := make([]query, 0, len(queries))
+	// the statements equal after the rewrite may still differ in their
+	// literals, the first literal of the statement is kept
+	literals := map[string]string{}
+	for _, q := range queries {
+		text := unquote(q.Value)
+		r := rewrite(text)
+		if r != text {
+			q.Value = requote(q.Value, r)
+		}
+		if literal, ok := literals[r]; ok {
+			q.Value = literal
+		} else {
+			literals[r] = q.Value
+		}
+		rewritten = append(rewritten, q)
+	}
+
+	return uniqueQueries(rewritten)
+}
+
+// requote returns the Go literal of the text, the raw string literals
+// stay raw if possible
+func requote(literal, text string) string {
+	if strings.HasPrefix(literal, "`") && !strings.Contains(text, "`") {
+		return "`" + text + "`"
+	}
+	return strconv.Quote(text)
+}
+
+// rawQueries returns the queries with their literals turned into raw
+// string literals if their texts can be, the others are kept as is
+func rawQueries(queries []query) []query {
+	raw := make([]query, 0, len(queries))
+	for _, q := range queries {
+		if text := unquote(q.Value); canBeRaw(text) {
+			q.Value = "`" + text + "`"
+		}
+		raw = append(raw, q)
+	}
+	return uniqueQueries(raw)
+}
+
+// canBeRaw reports whether the text can be written as a raw string
+// literal evaluating to the same text, the raw strings can't hold
+// backticks and drop the carriage returns while the Go source can't hold
+// the invalid UTF-8, NUL bytes and byte order marks
+func canBeRaw(text string) bool {
+	if !utf8.ValidString(text) || strings.ContainsAny(text, "`\r\x00\ufeff") {
+		return false
+	}
+	value, err := strconv.Unquote("`" + text + "`")
+	return err == nil && value == text
+}
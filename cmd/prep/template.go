@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/wayfarer-games/prep/tmpl"
+)
+
+// templateFuncs are the functions the template of -template can call
+// besides the builtin ones
+var templateFuncs = template.FuncMap{
+	"quote":   strconv.Quote,
+	"comment": commentBlock,
+	"join":    strings.Join,
+}
+
+// defaultTemplate is the template of the Go code generated without
+// -template
+var defaultTemplate = template.Must(template.New("default.tmpl").Funcs(templateFuncs).Option("missingkey=error").Parse(tmpl.Default))
+
+// readTemplate returns the parsed template of the file
+func readTemplate(fileName string) (*template.Template, error) {
+	text, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %v", err)
+	}
+
+	parsed, err := template.New(filepath.Base(fileName)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %v", err)
+	}
+	return parsed, nil
+}
+
+// newTemplateData returns the data of the template for the target, the
+// statements of the map are sorted by their elements
+func newTemplateData(t target, queries []query, keyed bool) tmpl.Data {
+	// the generated functions index the rendered statements, the ones
+	// without a value are left out of both
+	valued := make([]query, 0, len(queries))
+	for _, q := range queries {
+		if q.Value != "" {
+			valued = append(valued, q)
+		}
+	}
+	queries = valued
+
+	set := newPreparedSet(t, queries, keyed)
+	if keyed {
+		element := func(q query) string { return fmt.Sprintf("%q: %s", queryKey(q), q.Value) }
+		queries = append([]query{}, queries...)
+		sort.Slice(queries, func(i, j int) bool { return element(queries[i]) < element(queries[j]) })
+	}
+
+	data := tmpl.Data{
+		Header:        t.header,
+		Package:       t.packageName,
+		SourcePackage: t.sourcePackageName,
+		ImportPath:    t.importPath,
+		Var:           t.varName,
+		Declare:       t.declare,
+		Append:        t.appendStatements,
+		Map:           keyed,
+		Dialect:       t.dialect,
+		Checksum:      t.checksum,
+		Queries:       []tmpl.Query{},
+		Imports:       prepareImports(t),
+		Declarations:  prepareCode(t, set),
+	}
+	if t.statementIDs != nil {
+		data.Declarations = statementIDsCode(t) + data.Declarations
+	}
+
+	if t.manual.found {
+		data.Manual = &tmpl.Manual{Begin: manualBeginMarker, End: manualEndMarker, Entries: []string{}}
+		for _, entry := range t.manual.entries {
+			data.Manual.Entries = append(data.Manual.Entries, entry.text)
+		}
+	}
+
+	if t.templates != nil {
+		data.Formats = &tmpl.Formats{Var: templatesVarName, Literals: t.templates}
+		if t.declare {
+			data.Formats.Var = exportedName(templatesVarName)
+		}
+	}
+
+	for _, q := range queries {
+		sql := unquote(q.Value)
+		sum := sha256.Sum256([]byte(sql))
+		tq := tmpl.Query{
+			Name:      q.Name,
+			Key:       queryKey(q),
+			SQL:       sql,
+			Literal:   q.Value,
+			Hash:      hex.EncodeToString(sum[:]),
+			Comment:   sourceComment(t, q),
+			Positions: []tmpl.Position{},
+		}
+
+		positions := append([]token.Position{}, q.Pos...)
+		sort.Slice(positions, func(i, j int) bool { return positionLess(positions[i], positions[j]) })
+		for _, pos := range positions {
+			tq.Positions = append(tq.Positions, tmpl.Position{File: t.relativePath(pos.Filename), Line: pos.Line, Column: pos.Column})
+		}
+		data.Queries = append(data.Queries, tq)
+	}
+	return data
+}
+
+// executeTemplate returns the contents of the file generated by the
+// template, the Go code is formatted by gofmt
+func executeTemplate(text *template.Template, outputPath string, data tmpl.Data) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+	if err := text.Execute(buf, data); err != nil {
+		return nil, fmt.Errorf("failed to execute template: %v", err)
+	}
+
+	if !strings.HasSuffix(outputPath, ".go") {
+		return buf.Bytes(), nil
+	}
+	return formatGo(buf.Bytes())
+}
+
+// templateCode returns the contents of the file generated for the target
+// by the template of -template
+func templateCode(t target, outputPath string, queries []query, opts *options) ([]byte, error) {
+	var err error
+	if t.header, err = fileHeader(t.header, opts); err != nil {
+		return nil, err
+	}
+
+	text, err := readTemplate(opts.templateFile)
+	if err != nil {
+		return nil, err
+	}
+	return executeTemplate(text, outputPath, newTemplateData(t, queries, opts.format == formatMap))
+}
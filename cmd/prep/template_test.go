@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// directiveLine matches the go:generate directive of the generated file
+var directiveLine = regexp.MustCompile(`(?m)^//go:generate .*$`)
+
+func TestDefaultTemplate(t *testing.T) {
+	defaultFile, err := filepath.Abs(filepath.Join("..", "..", "tmpl", "default.tmpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		// dir is the directory of -dir, it's made absolute for the
+		// positions of the comments to be relative to it
+		dir  string
+		file string
+	}{
+		{
+			name: "slice",
+			args: []string{"-o", "slice.go", "-prepare-all", "-sqlx", "-struct", "-statement-names", "-extract-sprintf"},
+			file: "slice.go",
+		},
+		{
+			name: "map",
+			args: []string{"-o", "map.go", "-format", "map", "-prepare-all", "-sqlx", "-struct", "-statement-names"},
+			file: "map.go",
+		},
+		{
+			name: "manual",
+			args: []string{"-o", "manual.go", "-append"},
+			file: "manual.go",
+		},
+		{
+			name: "append init",
+			args: []string{"-o", "append_init.go", "-append-init", "-statement-names"},
+			file: "append_init.go",
+		},
+		{
+			name: "empty",
+			args: []string{"-o", "empty.go", "-allow-empty", "-exclude-query", "."},
+			file: "empty.go",
+		},
+		{
+			name: "empty append",
+			args: []string{"-o", "empty_append.go", "-allow-empty", "-append-init", "-exclude-query", "."},
+			file: "empty_append.go",
+		},
+		{
+			name: "declared",
+			args: []string{"-o", "declared.go", "-prepare-all", "-extract-sprintf"},
+			dir:  "queries",
+			file: "queries/declared.go",
+		},
+	}
+
+	for _, test := range tests {
+		// generate runs the fixture with the flags of the test followed
+		// by the extra ones and returns the generated file
+		generate := func(t *testing.T, extra ...string) (string, []byte) {
+			t.Helper()
+
+			dir := fixture(t, "template")
+			args := append(append([]string{"-f", "."}, test.args...), extra...)
+			if test.dir != "" {
+				abs, err := filepath.Abs(test.dir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				args = append(args, "-dir", abs)
+			}
+			if result := runFixture(t, args...); result.exitCode != exitOK {
+				t.Fatalf("exit code %d", result.exitCode)
+			}
+
+			code, err := os.ReadFile(test.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return dir, code
+		}
+
+		t.Run(test.name, func(t *testing.T) {
+			var code, templated []byte
+			t.Run("default", func(t *testing.T) {
+				var dir string
+				dir, code = generate(t)
+				checkGolden(t, dir, test.file)
+			})
+			t.Run("template", func(t *testing.T) {
+				_, templated = generate(t, "-template", defaultFile)
+			})
+
+			// the directives differ by -template only
+			if got, want := directiveLine.ReplaceAll(templated, nil), directiveLine.ReplaceAll(code, nil); string(got) != string(want) {
+				t.Errorf("the default template generates\n%s\nwant\n%s", templated, code)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var db *sqlx.DB
+
+func init() {
+	db.MustExecContext(context.Background(), `CREATE TABLE IF NOT EXISTS users (id serial, name text)`)
+	db.MustExec(`CREATE INDEX IF NOT EXISTS users_name ON users (name)`)
+}
+
+func mustSetup(db *sqlx.DB) bool {
+	return db != nil
+}
+
+// the package level initializers call the handles
+var (
+	_     = mustSetup(db.Unsafe())
+	_     = db.MustExec(`CREATE TABLE IF NOT EXISTS events (id serial, name text)`)
+	ready = db.MustExecContext(context.Background(), `CREATE TABLE IF NOT EXISTS audit (id serial)`) != nil
+)
+
+type migration struct {
+	name   string
+	result sql.Result
+	apply  func() error
+}
+
+// the field values of the composite literals call the handles
+var migrations = []migration{
+	{name: "sessions", result: db.MustExec(`CREATE TABLE IF NOT EXISTS sessions (id serial)`)},
+	{
+		name: "tokens",
+		apply: func() error {
+			_, err := db.ExecContext(context.Background(), `CREATE TABLE IF NOT EXISTS tokens (id serial)`)
+			return err
+		},
+	},
+}
+
+func seed() map[string]sql.Result {
+	return map[string]sql.Result{
+		"admin": db.MustExec(`INSERT INTO users (name) VALUES ('admin')`),
+	}
+}
@@ -0,0 +1,40 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type user struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+func twoLinks(ctx context.Context, db *sqlx.DB) {
+	var u user
+	db.Unsafe().GetContext(ctx, &u, "SELECT * FROM users WHERE id = $1", 1)
+	db.MustBegin().ExecContext(ctx, "UPDATE users SET seen = now()")
+}
+
+func threeLinks(ctx context.Context, db *sqlx.DB) {
+	var users []user
+	db.MustBegin().Unsafe().SelectContext(ctx, &users, "SELECT * FROM users")
+	db.Unsafe().Unsafe().MustExec("DELETE FROM sessions")
+}
+
+// the statement rebound to the transaction takes the arguments only
+func rebound(ctx context.Context, db *sqlx.DB, tx *sqlx.Tx) {
+	stmt, _ := db.PreparexContext(ctx, "SELECT name FROM users WHERE id = $1")
+	tx.StmtxContext(ctx, stmt).QueryRowxContext(ctx, "not a statement")
+	tx.Stmtx(stmt).Unsafe().QueryRowx("not a statement")
+}
+
+type cache struct{}
+
+func (cache) Unsafe() cache                                     { return cache{} }
+func (cache) ExecContext(ctx context.Context, key string) error { return nil }
+
+func notHandle(ctx context.Context, c cache) {
+	c.Unsafe().ExecContext(ctx, "user:1")
+}
@@ -0,0 +1,21 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+const (
+	selectBase  = "SELECT name FROM users"
+	orderClause = " ORDER BY name"
+)
+
+func users(ctx context.Context, db *sql.DB, filter string) {
+	// the concatenations of the constants and literals are folded
+	db.QueryContext(ctx, selectBase+orderClause)
+	db.QueryContext(ctx, (selectBase + " WHERE id = $1"), 1)
+
+	// the concatenations involving variables are left out with a
+	// warning
+	db.QueryContext(ctx, selectBase+" WHERE "+filter)
+}
@@ -0,0 +1,16 @@
+package store
+
+import "database/sql"
+
+// the block is split across the files of the package
+const (
+	selectAccount, deleteAccount = "SELECT balance FROM accounts WHERE id = $1", "DELETE FROM accounts WHERE id = $1"
+	_, _, closeAccount           = "SELECT 'blank'", "SELECT 'blank'", "UPDATE accounts SET closed = true WHERE id = $1"
+)
+
+func accounts(db *sql.DB) {
+	db.QueryRow(selectAccount, 1)
+	db.Exec(deleteAccount, 1)
+	db.Exec(closeAccount, 1)
+	db.QueryRow(selectUser, 2)
+}
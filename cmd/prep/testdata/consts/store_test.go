@@ -0,0 +1,14 @@
+package store_test
+
+import (
+	"database/sql"
+	"testing"
+)
+
+// the external test package declares a constant of the same name
+const selectUser = "SELECT name FROM users WHERE email = $1"
+
+func TestUsers(t *testing.T) {
+	var db *sql.DB
+	db.QueryRow(selectUser, "ann@example.com")
+}
@@ -0,0 +1,26 @@
+package store
+
+import "database/sql"
+
+const (
+	selectUser, deleteUser = "SELECT name FROM users WHERE id = $1", "DELETE FROM users WHERE id = $1"
+	_, countUsers          = "SELECT 'blank'", "SELECT count(*) FROM users"
+	insertUser             = "INSERT INTO users (name) VALUES ($1)"
+)
+
+const (
+	_ = "SELECT 'blank'"
+	// the spec without a value repeats the previous one
+	updateUser = "UPDATE users SET name = $1 WHERE id = $2"
+	renameUser
+)
+
+func users(db *sql.DB) {
+	db.QueryRow(selectUser, 1)
+	db.Exec(deleteUser, 1)
+	db.QueryRow(countUsers)
+	db.Exec(insertUser, "ann")
+	db.Exec(updateUser, "bob", 1)
+	db.Exec(renameUser, "carl", 2)
+	db.Exec(selectAccount, 1)
+}
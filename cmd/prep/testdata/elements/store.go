@@ -0,0 +1,20 @@
+package store
+
+import "database/sql"
+
+var prepStatements []string
+
+const (
+	selectUser = "SELECT name FROM users WHERE id = $1"
+	deleteUser = "DELETE FROM users WHERE id = $1"
+)
+
+// migrations mixes the constant of the generated file, which isn't
+// scanned, into the constants
+var migrations = []string{selectUser, legacyQuery, deleteUser, "UPDATE users SET seen = now()"}
+
+func migrate(db *sql.DB) {
+	for _, statement := range migrations {
+		db.Exec(statement)
+	}
+}
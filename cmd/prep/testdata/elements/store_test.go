@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+type (
+	// failingDriver fails to prepare its statement
+	failingDriver struct {
+		statement string
+	}
+
+	failingConn struct {
+		statement string
+	}
+
+	failingStmt struct{}
+)
+
+func (d failingDriver) Open(string) (driver.Conn, error) {
+	return failingConn{statement: d.statement}, nil
+}
+
+func (c failingConn) Prepare(query string) (driver.Stmt, error) {
+	if query == c.statement {
+		return nil, errors.New("syntax error")
+	}
+	return failingStmt{}, nil
+}
+
+func (c failingConn) Close() error {
+	return nil
+}
+
+func (c failingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("unexpected begin")
+}
+
+func (s failingStmt) Close() error {
+	return nil
+}
+
+func (s failingStmt) NumInput() int {
+	return -1
+}
+
+func (s failingStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("unexpected exec")
+}
+
+func (s failingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return nil, errors.New("unexpected query")
+}
+
+// TestKeys checks the statements failing to prepare are reported by the
+// keys of their constants
+func TestKeys(t *testing.T) {
+	for key, statement := range map[string]string{"selectUser": selectUser, "deleteUser": deleteUser} {
+		name := "failing-" + key
+		sql.Register(name, failingDriver{statement: statement})
+		db, err := sql.Open(name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = prepareAll(context.Background(), db)
+		var prepareErr *prepareError
+		if !errors.As(err, &prepareErr) || prepareErr.Key != key || prepareErr.Query != statement {
+			t.Errorf("prepareAll: got error %v, want the error of %s %s", err, key, statement)
+		}
+
+		_, err = newStatements(context.Background(), db)
+		if !errors.As(err, &prepareErr) || prepareErr.Key != key || prepareErr.Query != statement {
+			t.Errorf("newStatements: got error %v, want the error of %s %s", err, key, statement)
+		}
+	}
+}
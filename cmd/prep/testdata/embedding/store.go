@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type user struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+// UserRepo promotes the methods of the embedded handle
+type UserRepo struct {
+	*sqlx.DB
+}
+
+func (r *UserRepo) get(ctx context.Context, id int) (user, error) {
+	var u user
+	err := r.GetContext(ctx, &u, "SELECT id, name FROM users WHERE id = $1", id)
+	return u, err
+}
+
+func (r *UserRepo) list(ctx context.Context) ([]user, error) {
+	var users []user
+	err := r.DB.SelectContext(ctx, &users, "SELECT id, name FROM users")
+	return users, err
+}
+
+// accountRepo embeds the repository, the methods are promoted twice
+type accountRepo struct {
+	UserRepo
+}
+
+func (r accountRepo) count(ctx context.Context) error {
+	var n int
+	return r.GetContext(ctx, &n, "SELECT count(*) FROM accounts")
+}
+
+type pinned struct {
+	conn *sql.Conn
+}
+
+type service struct {
+	db pinned
+}
+
+func (s *service) locks(ctx context.Context) {
+	s.db.conn.QueryContext(ctx, "SELECT pid FROM pg_locks")
+}
+
+// querier is implemented by the handles
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+type reader struct {
+	querier
+}
+
+func (r reader) events(ctx context.Context) {
+	r.QueryContext(ctx, "SELECT name FROM events")
+}
+
+type extReader struct {
+	sqlx.ExtContext
+}
+
+func (r *extReader) audit(ctx context.Context) {
+	r.ExecContext(ctx, "DELETE FROM audit WHERE created < now() - interval '1 year'")
+}
+
+// decoder embeds a type of the same method names which isn't a handle
+type decoder struct {
+	*lookup
+}
+
+type lookup struct{}
+
+func (*lookup) QueryContext(ctx context.Context, key string) error { return nil }
+
+func (d decoder) find(ctx context.Context) {
+	d.QueryContext(ctx, "user:1")
+}
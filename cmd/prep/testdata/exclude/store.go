@@ -0,0 +1,16 @@
+package store
+
+import "database/sql"
+
+var prepStatements []string
+
+func users(db *sql.DB) {
+	db.Query("SELECT name FROM users")
+}
+
+// the fixtures of the tests are never prepared in production
+func fixtures(db *sql.DB) {
+	db.Exec("CREATE TEMP TABLE scratch (id int)")
+	db.Exec(`DELETE   FROM
+		sessions`)
+}
@@ -0,0 +1,12 @@
+// Package pgconn is the fake of github.com/jackc/pgx/v5/pgconn the
+// fixtures of the tests are built against, it declares the API only.
+package pgconn
+
+type (
+	CommandTag struct{}
+
+	StatementDescription struct {
+		Name string
+		SQL  string
+	}
+)
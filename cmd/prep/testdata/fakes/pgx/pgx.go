@@ -0,0 +1,62 @@
+// Package pgx is the fake of github.com/jackc/pgx/v5 the fixtures of
+// the tests are built against, it declares the API only, Conn.Prepare
+// fails.
+package pgx
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type (
+	Conn struct{}
+
+	Tx interface {
+		Begin(ctx context.Context) (Tx, error)
+		Commit(ctx context.Context) error
+		Rollback(ctx context.Context) error
+		Prepare(ctx context.Context, name, sql string) (*pgconn.StatementDescription, error)
+		Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+		Query(ctx context.Context, sql string, args ...any) (Rows, error)
+		QueryRow(ctx context.Context, sql string, args ...any) Row
+	}
+
+	Rows interface {
+		Close()
+		Next() bool
+		Scan(dest ...any) error
+	}
+
+	Row interface {
+		Scan(dest ...any) error
+	}
+
+	Batch struct{}
+
+	QueuedQuery struct {
+		SQL string
+	}
+
+	BatchResults interface {
+		Close() error
+	}
+)
+
+func Connect(ctx context.Context, connString string) (*Conn, error) { return nil, nil }
+
+func (c *Conn) Begin(ctx context.Context) (Tx, error) { return nil, nil }
+func (c *Conn) Prepare(ctx context.Context, name, sql string) (*pgconn.StatementDescription, error) {
+	return nil, errors.New("prepare failed")
+}
+func (c *Conn) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+func (c *Conn) Query(ctx context.Context, sql string, args ...any) (Rows, error) { return nil, nil }
+func (c *Conn) QueryRow(ctx context.Context, sql string, args ...any) Row        { return nil }
+func (c *Conn) SendBatch(ctx context.Context, b *Batch) BatchResults             { return nil }
+func (c *Conn) Close(ctx context.Context) error                                  { return nil }
+
+func (b *Batch) Queue(query string, arguments ...any) *QueuedQuery { return nil }
+func (b *Batch) Len() int                                          { return 0 }
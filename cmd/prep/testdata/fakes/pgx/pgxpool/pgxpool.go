@@ -0,0 +1,58 @@
+// Package pgxpool is the fake of github.com/jackc/pgx/v5/pgxpool the
+// fixtures of the tests are built against, it declares the API only.
+package pgxpool
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type (
+	Pool struct{}
+
+	Conn struct{}
+
+	Tx struct{}
+
+	Config struct {
+		AfterConnect func(context.Context, *pgx.Conn) error
+	}
+)
+
+func New(ctx context.Context, connString string) (*Pool, error) { return nil, nil }
+func ParseConfig(connString string) (*Config, error)            { return nil, nil }
+func NewWithConfig(ctx context.Context, config *Config) (*Pool, error) {
+	return nil, nil
+}
+
+func (p *Pool) Acquire(ctx context.Context) (*Conn, error) { return nil, nil }
+func (p *Pool) Begin(ctx context.Context) (pgx.Tx, error)  { return nil, nil }
+func (p *Pool) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+func (p *Pool) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, nil
+}
+func (p *Pool) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row { return nil }
+func (p *Pool) SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults  { return nil }
+func (p *Pool) Close()                                                        {}
+
+func (c *Conn) Conn() *pgx.Conn { return nil }
+func (c *Conn) Release()        {}
+func (c *Conn) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+func (c *Conn) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, nil
+}
+func (c *Conn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row { return nil }
+
+func (tx *Tx) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, nil
+}
+func (tx *Tx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return nil, nil
+}
+func (tx *Tx) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row { return nil }
@@ -0,0 +1,229 @@
+// Package sqlx is the fake of github.com/jmoiron/sqlx the fixtures of
+// the tests are built against, it declares the API only.
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+)
+
+type (
+	DB struct {
+		*sql.DB
+	}
+
+	Tx struct {
+		*sql.Tx
+	}
+
+	Conn struct {
+		*sql.Conn
+	}
+
+	Stmt struct {
+		*sql.Stmt
+	}
+
+	NamedStmt struct {
+		QueryString string
+		Stmt        *Stmt
+	}
+
+	Row struct{}
+
+	Rows struct {
+		*sql.Rows
+	}
+
+	Queryer interface {
+		Query(query string, args ...interface{}) (*sql.Rows, error)
+		Queryx(query string, args ...interface{}) (*Rows, error)
+		QueryRowx(query string, args ...interface{}) *Row
+	}
+
+	QueryerContext interface {
+		QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+		QueryxContext(ctx context.Context, query string, args ...interface{}) (*Rows, error)
+		QueryRowxContext(ctx context.Context, query string, args ...interface{}) *Row
+	}
+
+	Execer interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	}
+
+	ExecerContext interface {
+		ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	}
+
+	Ext interface {
+		DriverName() string
+		Rebind(query string) string
+		Queryer
+		Execer
+	}
+
+	ExtContext interface {
+		DriverName() string
+		Rebind(query string) string
+		QueryerContext
+		ExecerContext
+	}
+
+	Preparer interface {
+		Prepare(query string) (*sql.Stmt, error)
+	}
+
+	PreparerContext interface {
+		PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	}
+)
+
+func Open(driverName, dataSourceName string) (*DB, error) { return nil, nil }
+
+func Get(q Queryer, dest interface{}, query string, args ...interface{}) error    { return nil }
+func Select(q Queryer, dest interface{}, query string, args ...interface{}) error { return nil }
+func GetContext(ctx context.Context, q QueryerContext, dest interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func SelectContext(ctx context.Context, q QueryerContext, dest interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func NamedExec(e Ext, query string, arg interface{}) (sql.Result, error) { return nil, nil }
+func NamedQuery(e Ext, query string, arg interface{}) (*Rows, error)     { return nil, nil }
+func NamedExecContext(ctx context.Context, e ExtContext, query string, arg interface{}) (sql.Result, error) {
+	return nil, nil
+}
+func NamedQueryContext(ctx context.Context, e ExtContext, query string, arg interface{}) (*Rows, error) {
+	return nil, nil
+}
+func In(query string, args ...interface{}) (string, []interface{}, error) { return query, args, nil }
+
+func (db *DB) DriverName() string         { return "" }
+func (db *DB) Rebind(query string) string { return query }
+func (db *DB) Unsafe() *DB                { return db }
+func (db *DB) MustBegin() *Tx             { return nil }
+func (db *DB) Beginx() (*Tx, error)       { return nil, nil }
+func (db *DB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	return nil, nil
+}
+func (db *DB) Connx(ctx context.Context) (*Conn, error) { return nil, nil }
+
+func (db *DB) Get(dest interface{}, query string, args ...interface{}) error    { return nil }
+func (db *DB) Select(dest interface{}, query string, args ...interface{}) error { return nil }
+func (db *DB) Queryx(query string, args ...interface{}) (*Rows, error)          { return nil, nil }
+func (db *DB) QueryRowx(query string, args ...interface{}) *Row                 { return nil }
+func (db *DB) MustExec(query string, args ...interface{}) sql.Result            { return nil }
+func (db *DB) Preparex(query string) (*Stmt, error)                             { return nil, nil }
+func (db *DB) PrepareNamed(query string) (*NamedStmt, error)                    { return nil, nil }
+func (db *DB) NamedExec(query string, arg interface{}) (sql.Result, error)      { return nil, nil }
+func (db *DB) NamedQuery(query string, arg interface{}) (*Rows, error)          { return nil, nil }
+func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func (db *DB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	return nil, nil
+}
+func (db *DB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *Row {
+	return nil
+}
+func (db *DB) MustExecContext(ctx context.Context, query string, args ...interface{}) sql.Result {
+	return nil
+}
+func (db *DB) PreparexContext(ctx context.Context, query string) (*Stmt, error) { return nil, nil }
+func (db *DB) PrepareNamedContext(ctx context.Context, query string) (*NamedStmt, error) {
+	return nil, nil
+}
+func (db *DB) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return nil, nil
+}
+func (db *DB) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*Rows, error) {
+	return nil, nil
+}
+
+func (tx *Tx) DriverName() string         { return "" }
+func (tx *Tx) Rebind(query string) string { return query }
+func (tx *Tx) Unsafe() *Tx                { return tx }
+
+func (tx *Tx) Get(dest interface{}, query string, args ...interface{}) error    { return nil }
+func (tx *Tx) Select(dest interface{}, query string, args ...interface{}) error { return nil }
+func (tx *Tx) Queryx(query string, args ...interface{}) (*Rows, error)          { return nil, nil }
+func (tx *Tx) QueryRowx(query string, args ...interface{}) *Row                 { return nil }
+func (tx *Tx) MustExec(query string, args ...interface{}) sql.Result            { return nil }
+func (tx *Tx) Preparex(query string) (*Stmt, error)                             { return nil, nil }
+func (tx *Tx) PrepareNamed(query string) (*NamedStmt, error)                    { return nil, nil }
+func (tx *Tx) NamedExec(query string, arg interface{}) (sql.Result, error)      { return nil, nil }
+func (tx *Tx) NamedQuery(query string, arg interface{}) (*Rows, error)          { return nil, nil }
+func (tx *Tx) Stmtx(stmt interface{}) *Stmt                                     { return nil }
+func (tx *Tx) StmtxContext(ctx context.Context, stmt interface{}) *Stmt         { return nil }
+func (tx *Tx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func (tx *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func (tx *Tx) QueryxContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	return nil, nil
+}
+func (tx *Tx) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *Row {
+	return nil
+}
+func (tx *Tx) MustExecContext(ctx context.Context, query string, args ...interface{}) sql.Result {
+	return nil
+}
+func (tx *Tx) PreparexContext(ctx context.Context, query string) (*Stmt, error) { return nil, nil }
+func (tx *Tx) PrepareNamedContext(ctx context.Context, query string) (*NamedStmt, error) {
+	return nil, nil
+}
+func (tx *Tx) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return nil, nil
+}
+
+func (c *Conn) Rebind(query string) string { return query }
+func (c *Conn) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	return nil, nil
+}
+func (c *Conn) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func (c *Conn) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return nil
+}
+func (c *Conn) QueryxContext(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	return nil, nil
+}
+func (c *Conn) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *Row {
+	return nil
+}
+func (c *Conn) PreparexContext(ctx context.Context, query string) (*Stmt, error) { return nil, nil }
+
+func (s *Stmt) Unsafe() *Stmt                                      { return s }
+func (s *Stmt) Get(dest interface{}, args ...interface{}) error    { return nil }
+func (s *Stmt) Select(dest interface{}, args ...interface{}) error { return nil }
+func (s *Stmt) Queryx(args ...interface{}) (*Rows, error)          { return nil, nil }
+func (s *Stmt) QueryRowx(args ...interface{}) *Row                 { return nil }
+func (s *Stmt) MustExec(args ...interface{}) sql.Result            { return nil }
+func (s *Stmt) GetContext(ctx context.Context, dest interface{}, args ...interface{}) error {
+	return nil
+}
+func (s *Stmt) QueryRowxContext(ctx context.Context, args ...interface{}) *Row { return nil }
+
+func (s *NamedStmt) Close() error                                   { return nil }
+func (s *NamedStmt) Exec(arg interface{}) (sql.Result, error)       { return nil, nil }
+func (s *NamedStmt) Query(arg interface{}) (*sql.Rows, error)       { return nil, nil }
+func (s *NamedStmt) Queryx(arg interface{}) (*Rows, error)          { return nil, nil }
+func (s *NamedStmt) QueryRowx(arg interface{}) *Row                 { return nil }
+func (s *NamedStmt) Get(dest interface{}, arg interface{}) error    { return nil }
+func (s *NamedStmt) Select(dest interface{}, arg interface{}) error { return nil }
+func (s *NamedStmt) ExecContext(ctx context.Context, arg interface{}) (sql.Result, error) {
+	return nil, nil
+}
+func (s *NamedStmt) GetContext(ctx context.Context, dest interface{}, arg interface{}) error {
+	return nil
+}
+
+func (r *Row) Scan(dest ...interface{}) error     { return nil }
+func (r *Row) StructScan(dest interface{}) error  { return nil }
+func (r *Rows) StructScan(dest interface{}) error { return nil }
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type user struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+type account struct {
+	ID      int `db:"id"`
+	Balance int `db:"balance"`
+}
+
+const (
+	selectUser    = "SELECT id, name FROM users WHERE id = $1"
+	selectAccount = "SELECT id, balance FROM accounts WHERE id = $1"
+)
+
+// Get is the generic helper the query is forwarded to
+func Get[T any](ctx context.Context, db *sqlx.DB, query string, args ...any) (T, error) {
+	var v T
+	err := db.GetContext(ctx, &v, query, args...)
+	return v, err
+}
+
+// GetPair has several type parameters
+func GetPair[K comparable, V any](ctx context.Context, db *sqlx.DB, query string, key K) (V, error) {
+	var v V
+	err := db.GetContext(ctx, &v, query, key)
+	return v, err
+}
+
+// Find has the type argument inferred from dest
+func Find[T any](ctx context.Context, db *sqlx.DB, dest *T, query string, args ...any) error {
+	return db.GetContext(ctx, dest, query, args...)
+}
+
+func helpers(ctx context.Context, db *sqlx.DB) {
+	Get[user](ctx, db, selectUser, 1)
+	Get[account](ctx, db, selectAccount, 1)
+	GetPair[int, user](ctx, db, "SELECT id, name FROM users WHERE email = $1", 1)
+	GetPair[string, account](ctx, db, "SELECT id, balance FROM accounts WHERE owner = $1", "ann")
+
+	var u user
+	Find(ctx, db, &u, "SELECT id, name FROM users WHERE name = $1", "ann")
+}
+
+// Repo is the generic repository calling the handle itself
+type Repo[T any] struct {
+	db    *sqlx.DB
+	table string
+}
+
+func (r *Repo[T]) count(ctx context.Context) (int, error) {
+	var n int
+	err := r.db.GetContext(ctx, &n, "SELECT count(*) FROM users")
+	return n, err
+}
+
+func (r *Repo[T]) all(ctx context.Context) ([]T, error) {
+	var all []T
+	err := r.db.SelectContext(ctx, &all, "SELECT * FROM accounts")
+	return all, err
+}
+
+// Pair is the repository of several type parameters
+type Pair[K comparable, V any] struct {
+	*sqlx.DB
+}
+
+func (p Pair[K, V]) get(ctx context.Context, key K) (V, error) {
+	var v V
+	err := p.GetContext(ctx, &v, "SELECT value FROM pairs WHERE key = $1", key)
+	return v, err
+}
+
+func instantiated(ctx context.Context, db *sqlx.DB) {
+	users := &Repo[user]{db: db, table: "users"}
+	users.count(ctx)
+	Pair[string, int]{db}.get(ctx, "a")
+}
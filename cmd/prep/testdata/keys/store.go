@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+var prepStatements map[string]string
+
+// lit_2685d4 is named like the key of the literal SELECT now()
+const lit_2685d4 = "SELECT 1"
+
+func clock(ctx context.Context, db *sql.DB) {
+	db.QueryRowContext(ctx, "SELECT now()")
+	db.QueryRowContext(ctx, lit_2685d4)
+}
+
+func numbers(ctx context.Context, db *sql.DB) {
+	// the first three bytes of the hashes of the literals are the same
+	db.QueryRowContext(ctx, "SELECT 2643 AS n")
+	db.QueryRowContext(ctx, "SELECT 4473 AS n")
+}
@@ -0,0 +1,14 @@
+//go:build !postgres
+
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+const selectUser = "SELECT name FROM users WHERE id = ?"
+
+func user(ctx context.Context, db *sql.DB) {
+	db.QueryRowContext(ctx, selectUser, 1)
+}
@@ -0,0 +1,7 @@
+module example.com/fixture
+
+go 1.22
+
+require github.com/jmoiron/sqlx v1.4.0
+
+replace github.com/jmoiron/sqlx => ../fakes/sqlx
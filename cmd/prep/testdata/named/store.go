@@ -0,0 +1,59 @@
+package store
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+type user struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+const insertUser = `INSERT INTO users (name) VALUES (:name)`
+
+func handlers(db *sqlx.DB, u user) {
+	db.NamedExec(insertUser, u)
+	db.NamedQuery(`SELECT id FROM users WHERE name = :name`, u)
+}
+
+// store holds the statements prepared by newStore and executed by its
+// methods
+type store struct {
+	byName *sqlx.NamedStmt
+	update *sqlx.NamedStmt
+}
+
+func newStore(db *sqlx.DB) (*store, error) {
+	byName, err := db.PrepareNamed(`SELECT id, name FROM users WHERE name = :name`)
+	if err != nil {
+		return nil, err
+	}
+	update, err := prepareUpdate(db)
+	if err != nil {
+		return nil, err
+	}
+	return &store{byName: byName, update: update}, nil
+}
+
+func prepareUpdate(db *sqlx.DB) (*sqlx.NamedStmt, error) {
+	return db.PrepareNamed(`UPDATE users SET name = :name WHERE id = :id`)
+}
+
+// the executions of the named statements take the argument only, the
+// destination isn't a query
+func (s *store) get(name string) (user, error) {
+	var u user
+	err := s.byName.Get(&u, map[string]interface{}{"name": name})
+	return u, err
+}
+
+func (s *store) list(name string) ([]user, error) {
+	var users []user
+	err := s.byName.Select(&users, "SELECT 'not the query'")
+	return users, err
+}
+
+func (s *store) rename(u user) error {
+	_, err := s.update.Exec(u)
+	return err
+}
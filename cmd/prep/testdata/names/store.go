@@ -0,0 +1,28 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+const selectUser = "SELECT name FROM users WHERE id = $1"
+
+// selectAccount is a variable, its name doesn't identify the statement
+var selectAccount = "SELECT balance FROM accounts WHERE id = $1"
+
+func users(ctx context.Context, db *sql.DB) {
+	db.QueryRowContext(ctx, selectUser, 1)
+	db.QueryRowContext(ctx, selectAccount, 1)
+
+	// the local names are known in the function only
+	q := "DELETE FROM sessions WHERE user_id = $1"
+	db.ExecContext(ctx, q, 1)
+
+	const query = "UPDATE users SET seen = now() WHERE id = $1"
+	db.ExecContext(ctx, query, 1)
+}
+
+func accounts(ctx context.Context, db *sql.DB) {
+	q := "DELETE FROM accounts WHERE id = $1"
+	db.ExecContext(ctx, q, 1)
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const selectUser = "SELECT name FROM users WHERE id = $1"
+
+func conn(ctx context.Context, conn *pgx.Conn) {
+	conn.Exec(ctx, "UPDATE users SET seen = now() WHERE id = $1", 1)
+	conn.Query(ctx, "SELECT id FROM users")
+	conn.QueryRow(ctx, selectUser, 1)
+	conn.Prepare(ctx, "select_user", "SELECT name FROM users WHERE email = $1")
+}
+
+func tx(ctx context.Context, tx pgx.Tx) {
+	tx.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1", 1)
+	tx.Query(ctx, "SELECT id FROM sessions")
+	tx.QueryRow(ctx, selectUser, 2)
+}
+
+func pool(ctx context.Context, pool *pgxpool.Pool) {
+	pool.Exec(ctx, "INSERT INTO events (name) VALUES ($1)", "login")
+	pool.Query(ctx, "SELECT name FROM events")
+	pool.QueryRow(ctx, "SELECT count(*) FROM events")
+
+	c, _ := pool.Acquire(ctx)
+	defer c.Release()
+	c.Exec(ctx, "SELECT pg_advisory_lock($1)", 1)
+	c.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", 1)
+}
+
+func batch(ctx context.Context, conn *pgx.Conn) {
+	b := &pgx.Batch{}
+	b.Queue("INSERT INTO audit (event) VALUES ($1)", "batch")
+	conn.SendBatch(ctx, b)
+}
+
+// the database/sql methods of the same names take the query first
+func std(db *sql.DB) {
+	db.Exec("UPDATE accounts SET balance = 0")
+	db.Query("SELECT id FROM accounts")
+	db.QueryRow("SELECT balance FROM accounts WHERE id = $1", 1)
+}
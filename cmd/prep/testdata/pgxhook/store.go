@@ -0,0 +1,17 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// prepStatements is assigned by the generated code
+var prepStatements []string
+
+// the 40th byte of the statement is in the middle of a rune
+const selectNames = "SELECT 'xéééééééééééééééééééé'"
+
+func names(ctx context.Context, pool *pgxpool.Pool) {
+	pool.Query(ctx, selectNames)
+}
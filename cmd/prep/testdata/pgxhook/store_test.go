@@ -0,0 +1,25 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// the hook is generated by the test of prep
+func TestPrepareOnConnect(t *testing.T) {
+	err := prepareOnConnect(context.Background(), &pgx.Conn{})
+	if err == nil {
+		t.Fatal("prepareOnConnect succeeds with the failing Prepare")
+	}
+	if !utf8.ValidString(err.Error()) {
+		t.Errorf("the error %q isn't valid UTF-8", err)
+	}
+	// the prefix is cut before the rune of the 40th byte
+	if prefix := "SELECT 'x" + strings.Repeat("é", 15) + "..."; !strings.Contains(err.Error(), prefix) {
+		t.Errorf("the error %q misses the prefix %q", err, prefix)
+	}
+}
@@ -0,0 +1,13 @@
+module example.com/fixture
+
+go 1.22
+
+require (
+	github.com/jackc/pgx/v5 v5.7.1
+	github.com/jmoiron/sqlx v1.4.0
+)
+
+replace (
+	github.com/jackc/pgx/v5 => ../fakes/pgx
+	github.com/jmoiron/sqlx => ../fakes/sqlx
+)
@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// prepStatements is assigned by the generated code
+var prepStatements []string
+
+const (
+	selectUser = "SELECT name FROM users WHERE id = $1"
+	insertUser = "INSERT INTO users (name) VALUES (:name)"
+)
+
+func users(ctx context.Context, db *sql.DB, dbx *sqlx.DB) {
+	db.QueryRowContext(ctx, selectUser, 1)
+	db.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = $1", 1)
+	dbx.NamedExecContext(ctx, insertUser, map[string]interface{}{"name": "ann"})
+}
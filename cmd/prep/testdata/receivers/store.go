@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// pinned runs the statements on the connection pinned from the pool
+func pinned(ctx context.Context, db *sql.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.ExecContext(ctx, "SET search_path TO tenant")
+	conn.QueryRowContext(ctx, "SELECT current_schema()")
+	conn.QueryContext(ctx, "SELECT id FROM tenant.users")
+	conn.PrepareContext(ctx, "SELECT name FROM tenant.users WHERE id = $1")
+	return nil
+}
+
+func transaction(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tx.QueryContext(ctx, "SELECT id FROM orders FOR UPDATE")
+	tx.ExecContext(ctx, "UPDATE orders SET status = $1", "paid")
+	tx.QueryRow("SELECT total FROM orders WHERE id = $1", 1)
+	return tx.Commit()
+}
+
+func sqlxTransaction(ctx context.Context, db *sqlx.DB) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ids []int
+	tx.SelectContext(ctx, &ids, "SELECT id FROM invoices FOR UPDATE")
+	tx.ExecContext(ctx, "DELETE FROM invoices WHERE paid")
+	return tx.Commit()
+}
+
+func sqlxPinned(ctx context.Context, db *sqlx.DB) error {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var n int
+	conn.GetContext(ctx, &n, "SELECT count(*) FROM invoices")
+	conn.QueryRowxContext(ctx, "SELECT max(id) FROM invoices")
+	conn.ExecContext(ctx, "SET lock_timeout = '1s'")
+	return nil
+}
+
+// cache shares the method names of the handles but isn't one
+type cache struct{}
+
+func (cache) ExecContext(ctx context.Context, key string) error { return nil }
+
+func notHandle(ctx context.Context, c cache) {
+	c.ExecContext(ctx, "user:1")
+}
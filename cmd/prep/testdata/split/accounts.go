@@ -0,0 +1,7 @@
+package store
+
+import "database/sql"
+
+func accounts(db *sql.DB) {
+	db.Exec("DELETE FROM accounts WHERE id = ?", 1)
+}
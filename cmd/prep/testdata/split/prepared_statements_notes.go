@@ -0,0 +1,3 @@
+package store
+
+// Statements of the notes are kept, the file isn't generated.
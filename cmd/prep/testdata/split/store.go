@@ -0,0 +1,9 @@
+package store
+
+import "database/sql"
+
+var prepStatements []string
+
+func users(db *sql.DB) {
+	db.Query("SELECT name FROM users")
+}
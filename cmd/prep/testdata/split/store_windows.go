@@ -0,0 +1,8 @@
+package store
+
+import "database/sql"
+
+// the statements of the platform files go with the ones of store.go
+func paths(db *sql.DB) {
+	db.Query("SELECT path FROM files WHERE drive = ?")
+}
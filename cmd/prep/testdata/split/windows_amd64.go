@@ -0,0 +1,9 @@
+package store
+
+import "database/sql"
+
+// the statements of the files named by the platform only go with the
+// statements found at no position
+func registry(db *sql.DB) {
+	db.Query("SELECT value FROM registry")
+}
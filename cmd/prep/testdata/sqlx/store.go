@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type user struct {
+	ID   int    `db:"id"`
+	Name string `db:"name"`
+}
+
+func db(ctx context.Context, db *sqlx.DB) {
+	var u user
+	var users []user
+
+	db.Get(&u, "SELECT 'db.Get'")
+	db.Select(&users, "SELECT 'db.Select'")
+	db.Queryx("SELECT 'db.Queryx'")
+	db.QueryRowx("SELECT 'db.QueryRowx'")
+	db.MustExec("SELECT 'db.MustExec'")
+	db.Preparex("SELECT 'db.Preparex'")
+	db.PrepareNamed("SELECT 'db.PrepareNamed', :id")
+	db.NamedExec("SELECT 'db.NamedExec', :id", u)
+	db.NamedQuery("SELECT 'db.NamedQuery', :id", u)
+
+	db.GetContext(ctx, &u, "SELECT 'db.GetContext'")
+	db.SelectContext(ctx, &users, "SELECT 'db.SelectContext'")
+	db.QueryxContext(ctx, "SELECT 'db.QueryxContext'")
+	db.QueryRowxContext(ctx, "SELECT 'db.QueryRowxContext'")
+	db.MustExecContext(ctx, "SELECT 'db.MustExecContext'")
+	db.PreparexContext(ctx, "SELECT 'db.PreparexContext'")
+	db.PrepareNamedContext(ctx, "SELECT 'db.PrepareNamedContext', :id")
+	db.NamedExecContext(ctx, "SELECT 'db.NamedExecContext', :id", u)
+	db.NamedQueryContext(ctx, "SELECT 'db.NamedQueryContext', :id", u)
+
+	// the statements take the arguments only
+	stmt, _ := db.Preparex("SELECT 'db.Preparex', 2")
+	stmt.Get(&u, "not a statement")
+	stmt.QueryRowx("not a statement")
+}
+
+func tx(ctx context.Context, tx *sqlx.Tx) {
+	var u user
+	var users []user
+
+	tx.Get(&u, "SELECT 'tx.Get'")
+	tx.Select(&users, "SELECT 'tx.Select'")
+	tx.Queryx("SELECT 'tx.Queryx'")
+	tx.QueryRowx("SELECT 'tx.QueryRowx'")
+	tx.MustExec("SELECT 'tx.MustExec'")
+	tx.Preparex("SELECT 'tx.Preparex'")
+	tx.PrepareNamed("SELECT 'tx.PrepareNamed', :id")
+	tx.NamedExec("SELECT 'tx.NamedExec', :id", u)
+	tx.NamedQuery("SELECT 'tx.NamedQuery', :id", u)
+
+	tx.GetContext(ctx, &u, "SELECT 'tx.GetContext'")
+	tx.SelectContext(ctx, &users, "SELECT 'tx.SelectContext'")
+	tx.QueryxContext(ctx, "SELECT 'tx.QueryxContext'")
+	tx.QueryRowxContext(ctx, "SELECT 'tx.QueryRowxContext'")
+	tx.MustExecContext(ctx, "SELECT 'tx.MustExecContext'")
+	tx.PreparexContext(ctx, "SELECT 'tx.PreparexContext'")
+	tx.PrepareNamedContext(ctx, "SELECT 'tx.PrepareNamedContext', :id")
+	tx.NamedExecContext(ctx, "SELECT 'tx.NamedExecContext', :id", u)
+
+}
+
+func functions(ctx context.Context, db *sqlx.DB) {
+	var u user
+
+	sqlx.Get(db, &u, "SELECT 'sqlx.Get'")
+	sqlx.Select(db, &u, "SELECT 'sqlx.Select'")
+	sqlx.GetContext(ctx, db, &u, "SELECT 'sqlx.GetContext'")
+	sqlx.SelectContext(ctx, db, &u, "SELECT 'sqlx.SelectContext'")
+	sqlx.NamedExec(db, "SELECT 'sqlx.NamedExec', :id", u)
+	sqlx.NamedQuery(db, "SELECT 'sqlx.NamedQuery', :id", u)
+	sqlx.NamedExecContext(ctx, db, "SELECT 'sqlx.NamedExecContext', :id", u)
+	sqlx.NamedQueryContext(ctx, db, "SELECT 'sqlx.NamedQueryContext', :id", u)
+	sqlx.In("SELECT 'sqlx.In' WHERE id IN (?)", []int{1})
+}
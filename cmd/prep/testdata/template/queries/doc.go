@@ -0,0 +1,2 @@
+// Package queries holds the statements of the store package.
+package queries
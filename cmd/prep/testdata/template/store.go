@@ -0,0 +1,20 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var prepStatements []string
+
+const selectUser = "SELECT id, name FROM users WHERE id = $1"
+
+const insertUser = `INSERT INTO users (name) VALUES (:name)`
+
+func users(db *sqlx.DB, table string) {
+	db.QueryRowx(selectUser, 1)
+	db.NamedExec(insertUser, map[string]any{"name": "gopher"})
+	db.Exec("DELETE FROM sessions WHERE user_id = $1", 1)
+	db.Queryx(fmt.Sprintf("SELECT count(*) FROM %s", table))
+}
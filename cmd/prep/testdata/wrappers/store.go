@@ -0,0 +1,30 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+// swap runs both of the statements, every parameter is forwarded
+func swap(ctx context.Context, db *sql.DB, q1, q2 string) error {
+	if _, err := db.ExecContext(ctx, q1); err != nil {
+		return err
+	}
+	_, err := db.ExecContext(ctx, q2)
+	return err
+}
+
+// count forwards the parameter to two calls
+func count(ctx context.Context, db *sql.DB, query string) (int, error) {
+	if _, err := db.QueryContext(ctx, query); err != nil {
+		return 0, err
+	}
+	var n int
+	err := db.QueryRowContext(ctx, query).Scan(&n)
+	return n, err
+}
+
+func users(ctx context.Context, db *sql.DB) {
+	swap(ctx, db, "UPDATE accounts SET balance = balance - 1", "UPDATE accounts SET balance = balance + 1")
+	count(ctx, db, "SELECT count(*) FROM users")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// dialectParsers maps the dialects to the parsers of their statements,
+// the postgres parser is linked with cgo only
+var dialectParsers = map[string]func(sql string) error{
+	dialectMySQL: parseMySQL,
+}
+
+// validateQueries returns an error if any of the queries fails the
+// validation, every such query is logged with the calls it is found at,
+// the queries of the constants annotated with //prep:novalidate are
+// skipped
+//
+// The statements pass the structural checks first: the quoted strings
+// and comments must be terminated, the parentheses balanced and the
+// statement must start with a known keyword. The statements of the
+// postgres and mysql dialects are then parsed by pg_query and the
+// vitess parser, the other dialects have no parser.
+func validateQueries(queries []query, dialect string) error {
+	if _, ok := dialectParsers[dialect]; !ok && dialect == dialectPostgres {
+		log.Printf("prep: the postgres parser needs cgo, -validate runs the structural checks only")
+	}
+
+	n := 0
+	for _, q := range queries {
+		if q.NoValidate {
+			continue
+		}
+
+		err := validateSQL(unquote(q.Value), dialect)
+		if err == nil {
+			continue
+		}
+
+		n++
+		if len(q.Pos) == 0 {
+			log.Printf("prep: invalid statement %s: %v", q.Value, err)
+		}
+		for _, pos := range q.Pos {
+			log.Printf("prep: %s:%d: invalid statement %s: %v", pos.Filename, pos.Line, q.Value, err)
+		}
+	}
+
+	if n > 0 {
+		return fmt.Errorf("%d queries fail the validation", n)
+	}
+	return nil
+}
+
+// validateSQL returns an error if the statement is malformed or fails
+// to parse in the dialect, the placeholders are substituted with the
+// dummy parameters before the statement is parsed
+func validateSQL(sql, dialect string) error {
+	segments, err := splitSQL(sql)
+	if err != nil {
+		return err
+	}
+
+	depth := 0
+	for _, s := range segments {
+		if s.kind != segmentCode {
+			continue
+		}
+
+		for i := 0; i < len(s.text); i++ {
+			switch s.text[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth < 0 {
+				return fmt.Errorf("offset %d: unbalanced )", s.offset+i)
+			}
+		}
+	}
+	if depth > 0 {
+		return errors.New("unclosed (")
+	}
+
+	switch kind := classify(sql); {
+	case kind == "":
+		return errors.New("empty statement")
+	case !isStatementKind(kind):
+		return fmt.Errorf("unknown statement keyword %q", kind)
+	}
+
+	if parse, ok := dialectParsers[dialect]; ok {
+		return parse(dummyParams(sql))
+	}
+	return nil
+}
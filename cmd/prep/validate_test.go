@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateSQL(t *testing.T) {
+	tests := []struct {
+		sql     string
+		dialect string
+		err     string
+	}{
+		{sql: "SELECT id FROM users", dialect: dialectNone},
+		{sql: "SELEC id FROM users", dialect: dialectNone, err: `unknown statement keyword "selec"`},
+		{sql: "SELECT (id FROM users", dialect: dialectNone, err: "unclosed ("},
+		{sql: "SELECT 'id FROM users", dialect: dialectNone, err: "offset 7: unterminated quoted string"},
+
+		// the keyword is known, the structural checks pass it
+		{sql: "SELECT id FROM FROM users", dialect: dialectNone},
+		{sql: "SELECT id FROM FROM users", dialect: dialectSQLite},
+		{sql: "SELECT id FROM FROM users", dialect: dialectPostgres, err: `offset 15: syntax error at or near "FROM"`},
+		{sql: "SELECT id FROM FROM users", dialect: dialectMySQL, err: "syntax error at position 20 near 'FROM'"},
+
+		{sql: "SELEC id FROM users", dialect: dialectPostgres, err: `unknown statement keyword "selec"`},
+		{sql: "SELECT id FROM users WHERE", dialect: dialectPostgres, err: "offset 26: syntax error at end of input"},
+
+		{sql: "SELECT id FROM users WHERE id = $1 AND name = $2 LIMIT $3 OFFSET $4", dialect: dialectPostgres},
+		{sql: "SELECT id::text FROM users WHERE name = :name LIMIT :limit", dialect: dialectPostgres},
+		{sql: "INSERT INTO users (name, data) VALUES ($1, $2::jsonb) RETURNING id", dialect: dialectPostgres},
+		{sql: "SELECT $$a ? $1$$ FROM users WHERE id = $1", dialect: dialectPostgres},
+		{sql: "SELECT x FROM t WHERE x = ANY($1) ORDER BY x DESC NULLS LAST", dialect: dialectPostgres},
+		{sql: "SELECT x FROM t ORDER BY x NULLS LAST", dialect: dialectMySQL, err: "syntax error"},
+
+		{sql: "SELECT id FROM users WHERE id = ? LIMIT ?, ?", dialect: dialectMySQL},
+		{sql: "UPDATE users SET name = :name WHERE id = :id", dialect: dialectMySQL},
+		{sql: "SELECT @n := ? FROM dual", dialect: dialectMySQL},
+		{sql: "SELECT DATE_ADD(created, INTERVAL ? DAY) FROM users", dialect: dialectMySQL},
+		{sql: "SELECT `order` FROM t WHERE a = '?' AND b = ?", dialect: dialectMySQL},
+		{sql: "SELECT id::text FROM users", dialect: dialectMySQL, err: "syntax error"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dialect+" "+test.sql, func(t *testing.T) {
+			if test.dialect == dialectPostgres {
+				if _, ok := dialectParsers[dialectPostgres]; !ok {
+					t.Skip("the postgres parser needs cgo")
+				}
+			}
+
+			err := validateSQL(test.sql, test.dialect)
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("got error %v, want %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDummyParams(t *testing.T) {
+	tests := []struct {
+		sql, want string
+	}{
+		{"SELECT ? LIMIT ?", "SELECT 0 LIMIT 0"},
+		{"SELECT $1, $12 FROM t", "SELECT 00, 000 FROM t"},
+		{"SELECT :name, :id2 FROM t", "SELECT 00000, 0000 FROM t"},
+		{"SELECT a::text, @v := 1 FROM t", "SELECT a::text, @v := 1 FROM t"},
+		{"SELECT '?', \"$1\", $$:a$$ -- ?\nFROM t", "SELECT '?', \"$1\", $$:a$$ -- ?\nFROM t"},
+		{"SELECT arr[1:2], $", "SELECT arr[1:2], $"},
+	}
+
+	for _, test := range tests {
+		if got := dummyParams(test.sql); got != test.want {
+			t.Errorf("dummyParams(%q) = %q, want %q", test.sql, got, test.want)
+		}
+		if got := dummyParams(test.sql); len(got) != len(test.sql) {
+			t.Errorf("dummyParams(%q) changed the length to %d", test.sql, len(got))
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+)
+
+// develVersion is reported when the binary carries no version information
+const develVersion = "devel"
+
+// version returns the module version of the binary
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" || info.Main.Version == "(devel)" {
+		return develVersion
+	}
+
+	return info.Main.Version
+}
+
+// printVersion prints the module version, VCS revision and build
+// date of the binary
+func printVersion(w io.Writer) {
+	revision, date, modified := "unknown", "unknown", ""
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				revision = setting.Value
+			case "vcs.time":
+				date = setting.Value
+			case "vcs.modified":
+				if setting.Value == "true" {
+					modified = " (modified)"
+				}
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "prep %s\nrevision: %s%s\ndate: %s\n", version(), revision, modified, date)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// watchInterval is the interval the source packages are polled at
+const watchInterval = 500 * time.Millisecond
+
+type (
+	// fileState is the state of a watched file
+	fileState struct {
+		modTime time.Time
+		size    int64
+	}
+
+	// snapshot maps the paths of the watched files to their states
+	snapshot map[string]fileState
+)
+
+// watch generates the code and regenerates it whenever the Go files of
+// the source packages change until the tool is interrupted, bursts of
+// changes are debounced until the files stay unchanged for a poll
+func watch(sourcePackageNames []string, opts *options) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	result := generateAll(sourcePackageNames, opts)
+	log.Printf("prep: generated %d queries, watching %d packages", result.queries, len(result.dirs))
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	state := takeSnapshot(result, opts)
+	pending := false
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("prep: stopped watching")
+			return exitOK
+		case <-ticker.C:
+		}
+
+		current := takeSnapshot(result, opts)
+		if !current.equal(state) {
+			state = current
+			pending = true
+			continue
+		}
+
+		if !pending {
+			continue
+		}
+		pending = false
+
+		previous := result.queries
+		result = generateAll(sourcePackageNames, opts)
+		state = takeSnapshot(result, opts)
+		log.Printf("prep: regenerated %d queries (%+d)", result.queries, result.queries-previous)
+	}
+}
+
+// takeSnapshot returns the states of the Go files in the directories of
+// the source packages of the run, the files generated by the tool are
+// not watched
+func takeSnapshot(result runResult, opts *options) snapshot {
+	outputs := map[string]struct{}{}
+	for _, path := range result.outputs {
+		outputs[path] = struct{}{}
+	}
+
+	s := snapshot{}
+	for _, dir := range result.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		outputs[outputPathFor(dir, opts)] = struct{}{}
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if _, ok := outputs[path]; ok || entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") {
+				continue
+			}
+
+			if info, err := entry.Info(); err == nil {
+				s[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+			}
+		}
+	}
+	return s
+}
+
+// equal reports whether both snapshots hold the same files in the same states
+func (s snapshot) equal(other snapshot) bool {
+	if len(s) != len(other) {
+		return false
+	}
+
+	for path, state := range s {
+		if otherState, ok := other[path]; !ok || !otherState.modTime.Equal(state.modTime) || otherState.size != state.size {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+// Package tmpl holds the data the templates of the -template flag of prep
+// are executed with and the default template of the Go code prep
+// generates without the flag.
+package tmpl
+
+import _ "embed"
+
+// Default is the template of the Go code prep generates without
+// -template, the custom templates may start from a copy of it
+//
+//go:embed default.tmpl
+var Default string
+
+type (
+	// Data is the data the template is executed with, the fields and
+	// their meaning are kept stable
+	Data struct {
+		// Header is the comment the generated file starts with, the
+		// standard "Code generated" line and the go:generate directive
+		// regenerating the file including
+		Header string
+		// Package is the name of the package of the generated file
+		Package string
+		// SourcePackage is the name of the scanned package
+		SourcePackage string
+		// ImportPath is the import path of the scanned package
+		ImportPath string
+		// Var is the name of the variable of the statements
+		Var string
+		// Declare reports whether the generated file is in a package
+		// of its own and has to declare the variable, it's assigned in
+		// init otherwise
+		Declare bool
+		// Append reports whether the statements are appended to the
+		// variable in init instead, the files written by
+		// -split-by-file and -append-init share the variable
+		Append bool
+		// Map reports whether the variable is the map of -format map
+		// keyed by the Key of the statements
+		Map bool
+		// Dialect is the SQL dialect of the statements
+		Dialect string
+		// Checksum is the checksum of the statements, see -format json,
+		// empty with -append-init
+		Checksum string
+		// Queries are the statements in the order of -sort
+		Queries []Query
+		// Manual holds the manually curated statements kept by
+		// -append, nil if the generated file has no manual markers
+		Manual *Manual
+		// Formats holds the format strings of the queries formatted
+		// by fmt.Sprintf, nil without -extract-sprintf
+		Formats *Formats
+		// Imports are the groups of the import paths of Declarations
+		Imports [][]string
+		// Declarations is the Go code following the variable generated
+		// by -statement-names, -pgx, -prepare-all, -sqlx and -struct
+		Declarations string
+	}
+
+	// Query is a statement of Data
+	Query struct {
+		// Name is the name of the constant holding the statement,
+		// empty for the string literals
+		Name string
+		// Key is the key of the statement in the map of -format map,
+		// the name of the constant or the hash of the statement
+		Key string
+		// SQL is the text of the statement
+		SQL string
+		// Literal is the Go literal of the statement
+		Literal string
+		// Hash is the hex encoded SHA-256 of SQL
+		Hash string
+		// Comment is the comment preceding the statement in the
+		// default output, the first positions and the constant, empty
+		// if there are neither
+		Comment string
+		// Positions are the positions of the calls the statement is
+		// found at sorted by the file and line
+		Positions []Position
+	}
+
+	// Position is a position of Query
+	Position struct {
+		// File is the path of the source file relative to the
+		// directory of the generated file
+		File   string
+		Line   int
+		Column int
+	}
+
+	// Manual is the manually curated section of the variable
+	Manual struct {
+		// Begin and End are the marker comments enclosing the section
+		Begin, End string
+		// Entries are the Go sources of the elements of the section
+		Entries []string
+	}
+
+	// Formats is the variable of the format strings of -extract-sprintf
+	Formats struct {
+		// Var is the name of the variable
+		Var string
+		// Literals are the Go literals of the format strings
+		Literals []string
+	}
+)